@@ -1,8 +1,14 @@
 import axios from 'axios';
 
+import { csrfCookieName, csrfHeaderName } from './csrf';
+
 const apiURL = import.meta.env.VITE_API_URL || 'https://localhost:8080';
 
 export default axios.create({
     baseURL: apiURL,
     headers: { 'Content-Type': 'application/json' },
+    // Echo the CSRF cookie set at login/refresh on mutating requests
+    xsrfCookieName: csrfCookieName,
+    xsrfHeaderName: csrfHeaderName,
+    withXSRFToken: true,
 })
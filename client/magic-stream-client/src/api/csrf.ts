@@ -0,0 +1,4 @@
+// The server names its cookies with COOKIE_PREFIX (e.g. "__Host-"), so the CSRF cookie
+// is only found if VITE_COOKIE_PREFIX is set to the same value.
+export const csrfCookieName = `${import.meta.env.VITE_COOKIE_PREFIX ?? ''}csrf_token`;
+export const csrfHeaderName = 'X-CSRF-Token';
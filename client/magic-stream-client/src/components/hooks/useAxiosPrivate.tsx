@@ -2,6 +2,7 @@ import { useEffect } from 'react';
 import axios from 'axios';
 
 import useAuth from './useAuth';
+import { csrfCookieName, csrfHeaderName } from '../../api/csrf';
 
 const apiUrl = import.meta.env.VITE_API_BASE_URL;
 
@@ -10,6 +11,9 @@ const useAxiosPrivate = () => {
   const axiosAuth = axios.create({
     baseURL: apiUrl,
     withCredentials: true, // important for HTTP-only cookies
+    xsrfCookieName: csrfCookieName, // double-submit CSRF token set by the server at login/refresh
+    xsrfHeaderName: csrfHeaderName,
+    withXSRFToken: true,
   });
 
 
@@ -0,0 +1,126 @@
+// Package catalog imports movies into the catalog from CSV and JSON Lines files, and
+// exports it as CSV, JSON Lines or JSON.
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// ListSeparator separates the values of list columns (genres, cast, directors, languages) in CSV files.
+const ListSeparator = "|"
+
+// Column is a field of the catalog files: a CSV column, or a key of the JSON forms.
+type Column struct {
+	Name string
+	// Field is the field of movie documents, and its key in JSON
+	Field string
+	// Required columns must be in the header of imported files
+	Required bool
+	// Value is the field as written in JSON
+	Value func(movie *models.Movie) any
+	Get   func(movie *models.Movie) string
+	// Set reads a non-empty cell into the movie
+	Set func(movie *models.Movie, value string) error
+}
+
+// Columns are the fields of the catalog files, in the order they are written. In CSV,
+// genres and the ranking are given by name.
+var Columns = []Column{
+	{Name: "imdb_id", Field: "imdb_id", Required: true,
+		Value: func(m *models.Movie) any { return m.ImdbID },
+		Get:   func(m *models.Movie) string { return m.ImdbID },
+		Set:   func(m *models.Movie, v string) error { m.ImdbID = v; return nil }},
+	{Name: "title", Field: "title", Required: true,
+		Value: func(m *models.Movie) any { return m.Title },
+		Get:   func(m *models.Movie) string { return m.Title },
+		Set:   func(m *models.Movie, v string) error { m.Title = v; return nil }},
+	{Name: "poster_path", Field: "poster_path", Required: true,
+		Value: func(m *models.Movie) any { return m.PosterPath },
+		Get:   func(m *models.Movie) string { return m.PosterPath },
+		Set:   func(m *models.Movie, v string) error { m.PosterPath = v; return nil }},
+	{Name: "youtube_id", Field: "youtube_id", Required: true,
+		Value: func(m *models.Movie) any { return m.YoutubeID },
+		Get:   func(m *models.Movie) string { return m.YoutubeID },
+		Set:   func(m *models.Movie, v string) error { m.YoutubeID = v; return nil }},
+	{Name: "genres", Field: "genre", Required: true,
+		Value: func(m *models.Movie) any { return m.Genre },
+		Get: func(m *models.Movie) string {
+			names := make([]string, 0, len(m.Genre))
+			for _, genre := range m.Genre {
+				names = append(names, genre.GenreName)
+			}
+			return strings.Join(names, ListSeparator)
+		},
+		Set: func(m *models.Movie, v string) error {
+			for _, name := range splitList(v) {
+				m.Genre = append(m.Genre, models.Genre{GenreName: name})
+			}
+			return nil
+		}},
+	{Name: "ranking", Field: "ranking",
+		Value: func(m *models.Movie) any { return m.Ranking },
+		Get:   func(m *models.Movie) string { return m.Ranking.RankingName },
+		Set:   func(m *models.Movie, v string) error { m.Ranking.RankingName = v; return nil }},
+	{Name: "admin_review", Field: "admin_review",
+		Value: func(m *models.Movie) any { return m.AdminReview },
+		Get:   func(m *models.Movie) string { return m.AdminReview },
+		Set:   func(m *models.Movie, v string) error { m.AdminReview = v; return nil }},
+	{Name: "release_year", Field: "release_year",
+		Value: func(m *models.Movie) any { return m.ReleaseYear },
+		Get:   func(m *models.Movie) string { return formatInt(m.ReleaseYear) },
+		Set:   func(m *models.Movie, v string) error { return parseInt("release_year", v, &m.ReleaseYear) }},
+	{Name: "runtime_minutes", Field: "runtime_minutes",
+		Value: func(m *models.Movie) any { return m.RuntimeMinutes },
+		Get:   func(m *models.Movie) string { return formatInt(m.RuntimeMinutes) },
+		Set:   func(m *models.Movie, v string) error { return parseInt("runtime_minutes", v, &m.RuntimeMinutes) }},
+	{Name: "cast", Field: "cast",
+		Value: func(m *models.Movie) any { return m.Cast },
+		Get:   func(m *models.Movie) string { return strings.Join(m.Cast, ListSeparator) },
+		Set:   func(m *models.Movie, v string) error { m.Cast = splitList(v); return nil }},
+	{Name: "directors", Field: "directors",
+		Value: func(m *models.Movie) any { return m.Directors },
+		Get:   func(m *models.Movie) string { return strings.Join(m.Directors, ListSeparator) },
+		Set:   func(m *models.Movie, v string) error { m.Directors = splitList(v); return nil }},
+	{Name: "age_rating", Field: "age_rating",
+		Value: func(m *models.Movie) any { return m.AgeRating },
+		Get:   func(m *models.Movie) string { return m.AgeRating },
+		Set:   func(m *models.Movie, v string) error { m.AgeRating = v; return nil }},
+	{Name: "languages", Field: "languages",
+		Value: func(m *models.Movie) any { return m.Languages },
+		Get:   func(m *models.Movie) string { return strings.Join(m.Languages, ListSeparator) },
+		Set:   func(m *models.Movie, v string) error { m.Languages = splitList(v); return nil }},
+	{Name: "synopsis", Field: "synopsis",
+		Value: func(m *models.Movie) any { return m.Synopsis },
+		Get:   func(m *models.Movie) string { return m.Synopsis },
+		Set:   func(m *models.Movie, v string) error { m.Synopsis = v; return nil }},
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ListSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func formatInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func parseInt(name, value string, target *int) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a whole number", name, value)
+	}
+	*target = parsed
+	return nil
+}
@@ -0,0 +1,221 @@
+package catalog
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// flushEvery is how many movies are buffered before they are written out
+	flushEvery = 100
+	// exportBatchSize is how many movies each round trip of the cursor fetches
+	exportBatchSize = 500
+)
+
+// ParseFields returns the columns named in a comma separated list, in the order of
+// Columns. An empty list selects all of them.
+func ParseFields(raw string) ([]Column, error) {
+	if strings.TrimSpace(raw) == "" {
+		return Columns, nil
+	}
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(Columns, func(c Column) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		names = append(names, name)
+	}
+	var columns []Column
+	for _, column := range Columns {
+		if slices.Contains(names, column.Name) {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// Export writes the movies matching filter to w in the given format, ordered by
+// imdb_id, and returns how many it wrote. Movies are read from a cursor and written as
+// they come, so the catalog is never held in memory; nothing is written before the
+// first movies are read. With all the columns, CSV and JSON Lines exports can be
+// imported again.
+func Export(ctx context.Context, w io.Writer, format string, columns []Column, filter bson.M, client *mongo.Client) (int64, error) {
+	buffered := bufio.NewWriterSize(w, 64*1024)
+	var enc encoder
+	switch format {
+	case models.CatalogFormatCSV:
+		enc = &csvEncoder{writer: csv.NewWriter(buffered), columns: columns}
+	case models.CatalogFormatJSONL:
+		enc = &jsonEncoder{writer: buffered, columns: columns}
+	case models.CatalogFormatJSON:
+		enc = &jsonEncoder{writer: buffered, columns: columns, array: true}
+	default:
+		return 0, fmt.Errorf("unknown format %q, expected csv, jsonl or json", format)
+	}
+
+	projection := bson.M{"_id": 0}
+	for _, column := range columns {
+		projection[column.Field] = 1
+	}
+	opts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.D{{Key: "imdb_id", Value: 1}}).
+		SetBatchSize(exportBatchSize)
+	cursor, err := database.OpenCollection("movies", client).Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	if err := enc.begin(); err != nil {
+		return 0, err
+	}
+	var count int64
+	for cursor.Next(ctx) {
+		var movie models.Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return count, err
+		}
+		if err := enc.write(&movie); err != nil {
+			return count, err
+		}
+		count++
+		if count%flushEvery == 0 {
+			if err := enc.flush(); err != nil {
+				return count, err
+			}
+			if err := buffered.Flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	if err := enc.end(); err != nil {
+		return count, err
+	}
+	return count, buffered.Flush()
+}
+
+// encoder writes movies in one of the export formats.
+type encoder interface {
+	begin() error
+	write(movie *models.Movie) error
+	// flush hands what the encoder buffers to the underlying writer
+	flush() error
+	end() error
+}
+
+type csvEncoder struct {
+	writer  *csv.Writer
+	columns []Column
+	record  []string
+}
+
+func (e *csvEncoder) begin() error {
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.Name
+	}
+	e.record = make([]string, len(e.columns))
+	return e.writer.Write(header)
+}
+
+func (e *csvEncoder) write(movie *models.Movie) error {
+	for i, column := range e.columns {
+		e.record[i] = column.Get(movie)
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) end() error {
+	return e.flush()
+}
+
+// jsonEncoder writes one object per movie with the keys of the columns, one per line,
+// or as the elements of an array.
+type jsonEncoder struct {
+	writer  *bufio.Writer
+	columns []Column
+	array   bool
+	written bool
+}
+
+func (e *jsonEncoder) begin() error {
+	if e.array {
+		_, err := e.writer.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (e *jsonEncoder) write(movie *models.Movie) error {
+	if e.array {
+		separator := "\n"
+		if e.written {
+			separator = ",\n"
+		}
+		if _, err := e.writer.WriteString(separator); err != nil {
+			return err
+		}
+	}
+	e.written = true
+
+	e.writer.WriteByte('{')
+	for i, column := range e.columns {
+		value, err := json.Marshal(column.Value(movie))
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", movie.ImdbID, column.Name, err)
+		}
+		if i > 0 {
+			e.writer.WriteByte(',')
+		}
+		fmt.Fprintf(e.writer, "%q:", column.Field)
+		e.writer.Write(value)
+	}
+	if e.array {
+		return e.writer.WriteByte('}')
+	}
+	_, err := e.writer.WriteString("}\n")
+	return err
+}
+
+func (e *jsonEncoder) flush() error {
+	return nil
+}
+
+func (e *jsonEncoder) end() error {
+	if e.array {
+		_, err := e.writer.WriteString("\n]\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	batchSize = 500
+	// unrankedValue is the ranking value of movies not ranked yet
+	unrankedValue = 999
+)
+
+var validate = validator.New()
+
+// vocabulary holds the genres and rankings movies are checked against.
+type vocabulary struct {
+	genresByName map[string]models.Genre
+	genresByID   map[int]models.Genre
+	rankings     map[string]models.Ranking
+	unranked     *models.Ranking
+}
+
+// Import upserts the rows into the movies collection by imdb_id, in batches, and
+// returns what it did. Rows that fail do not stop the import: they are counted and
+// reported through the tracker. A dry run checks the rows and counts what would be
+// inserted or updated without writing.
+//
+// Existing movies keep their user ratings and enrichment, and the fields a row leaves
+// empty, except for the required ones.
+func Import(ctx context.Context, rows []Row, format string, dryRun bool, tracker *jobs.Tracker, client *mongo.Client) (*models.ImportSummary, error) {
+	vocab, err := loadVocabulary(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.ImportSummary{Format: format, DryRun: dryRun, Rows: int64(len(rows))}
+	if err := tracker.SetTotal(ctx, summary.Rows); err != nil {
+		return nil, err
+	}
+
+	firstLine := make(map[string]int, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.Err != nil {
+			continue
+		}
+		row.rankingGiven = strings.TrimSpace(row.Movie.Ranking.RankingName) != ""
+		if row.Err = vocab.prepare(&row.Movie); row.Err != nil {
+			continue
+		}
+		if line, ok := firstLine[row.Movie.ImdbID]; ok {
+			row.Err = fmt.Errorf("duplicate of line %d", line)
+			continue
+		}
+		firstLine[row.Movie.ImdbID] = row.Line
+	}
+
+	for start := 0; start < len(rows); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch := rows[start:min(start+batchSize, len(rows))]
+		if err := importBatch(ctx, batch, dryRun, summary, tracker, client); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tracker.SetResult(ctx, summary); err != nil {
+		log.Printf("Catalog import %s: failed to record result: %v", tracker.JobID(), err)
+	}
+	return summary, nil
+}
+
+func importBatch(ctx context.Context, batch []Row, dryRun bool, summary *models.ImportSummary, tracker *jobs.Tracker, client *mongo.Client) error {
+	movies := database.OpenCollection("movies", client)
+
+	var valid []*Row
+	var imdbIDs []string
+	for i := range batch {
+		if batch[i].Err == nil {
+			valid = append(valid, &batch[i])
+			imdbIDs = append(imdbIDs, batch[i].Movie.ImdbID)
+		}
+	}
+
+	existing := make(map[string]bool, len(imdbIDs))
+	if len(imdbIDs) > 0 {
+		values, err := movies.Distinct(ctx, "imdb_id", bson.M{"imdb_id": bson.M{"$in": imdbIDs}}).Raw()
+		if err != nil {
+			return err
+		}
+		elements, err := values.Values()
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			if imdbID, ok := element.StringValueOK(); ok {
+				existing[imdbID] = true
+			}
+		}
+	}
+
+	if !dryRun && len(valid) > 0 {
+		writes := make([]mongo.WriteModel, 0, len(valid))
+		for _, row := range valid {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"imdb_id": row.Movie.ImdbID}).
+				SetUpdate(upsertUpdate(&row.Movie, row.rankingGiven)).
+				SetUpsert(true))
+		}
+		_, err := movies.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+			for _, writeErr := range bulkErr.WriteErrors {
+				valid[writeErr.Index].Err = errors.New(writeErr.Message)
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var succeeded int64
+	var failures []models.JobError
+	for i := range batch {
+		row := &batch[i]
+		if row.Err != nil {
+			failures = append(failures, models.JobError{Item: row.item(), Message: row.Err.Error()})
+			continue
+		}
+		succeeded++
+		if existing[row.Movie.ImdbID] {
+			summary.Updated++
+		} else {
+			summary.Inserted++
+		}
+	}
+	summary.Failed += int64(len(failures))
+	return tracker.Record(ctx, succeeded, 0, failures)
+}
+
+// upsertUpdate writes the fields of the movie. Optional fields left empty, and the
+// ranking when the row did not give one, are only written when the movie is inserted,
+// so that they do not erase stored values.
+func upsertUpdate(movie *models.Movie, rankingGiven bool) bson.M {
+	set := bson.M{
+		"title":          movie.Title,
+		"poster_path":    movie.PosterPath,
+		"youtube_id":     movie.YoutubeID,
+		"genre":          movie.Genre,
+		"schema_version": movie.SchemaVersion,
+	}
+	setOnInsert := bson.M{}
+	optional := func(field string, value any, empty bool) {
+		if empty {
+			setOnInsert[field] = value
+		} else {
+			set[field] = value
+		}
+	}
+	optional("ranking", movie.Ranking, !rankingGiven)
+	optional("admin_review", movie.AdminReview, movie.AdminReview == "")
+	optional("cast", movie.Cast, len(movie.Cast) == 0)
+	optional("directors", movie.Directors, len(movie.Directors) == 0)
+	optional("languages", movie.Languages, len(movie.Languages) == 0)
+	if movie.ReleaseYear != 0 {
+		set["release_year"] = movie.ReleaseYear
+	}
+	if movie.RuntimeMinutes != 0 {
+		set["runtime_minutes"] = movie.RuntimeMinutes
+	}
+	if movie.AgeRating != "" {
+		set["age_rating"] = movie.AgeRating
+	}
+	if movie.Synopsis != "" {
+		set["synopsis"] = movie.Synopsis
+	}
+	return bson.M{"$set": set, "$setOnInsert": setOnInsert}
+}
+
+// prepare resolves the genres and ranking of the movie by name, normalizes and
+// validates it. A movie without a ranking gets the unranked one.
+func (v *vocabulary) prepare(movie *models.Movie) error {
+	genres := make([]models.Genre, 0, len(movie.Genre))
+	for _, given := range movie.Genre {
+		genre, ok := v.genresByName[strings.ToLower(strings.TrimSpace(given.GenreName))]
+		if !ok && given.GenreName == "" {
+			genre, ok = v.genresByID[given.GenreID]
+		}
+		if !ok {
+			return fmt.Errorf("unknown genre %q", given.GenreName)
+		}
+		genres = append(genres, genre)
+	}
+	movie.Genre = genres
+
+	utils.NormalizeMovie(movie)
+
+	if name := strings.TrimSpace(movie.Ranking.RankingName); name != "" {
+		ranking, ok := v.rankings[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("unknown ranking %q", name)
+		}
+		movie.Ranking = ranking
+	} else {
+		if v.unranked == nil {
+			return errors.New("ranking is required, as there is no unranked ranking")
+		}
+		movie.Ranking = *v.unranked
+	}
+	if len(movie.Genre) == 0 {
+		return errors.New("at least one genre is required")
+	}
+	return validate.Struct(movie)
+}
+
+func loadVocabulary(ctx context.Context, client *mongo.Client) (*vocabulary, error) {
+	var genres []models.Genre
+	if err := findAll(ctx, "genres", &genres, client); err != nil {
+		return nil, err
+	}
+	var rankings []models.Ranking
+	if err := findAll(ctx, "rankings", &rankings, client); err != nil {
+		return nil, err
+	}
+
+	vocab := &vocabulary{
+		genresByName: make(map[string]models.Genre, len(genres)),
+		genresByID:   make(map[int]models.Genre, len(genres)),
+		rankings:     make(map[string]models.Ranking, len(rankings)),
+	}
+	for _, genre := range genres {
+		vocab.genresByName[strings.ToLower(genre.GenreName)] = genre
+		vocab.genresByID[genre.GenreID] = genre
+	}
+	for _, ranking := range rankings {
+		vocab.rankings[strings.ToLower(ranking.RankingName)] = ranking
+		if ranking.RankingValue == unrankedValue {
+			unranked := ranking
+			vocab.unranked = &unranked
+		}
+	}
+	return vocab, nil
+}
+
+func findAll(ctx context.Context, collectionName string, results any, client *mongo.Client) error {
+	cursor, err := database.OpenCollection(collectionName, client).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	return cursor.All(ctx, results)
+}
+
+// item names the row in the job's error report.
+func (r *Row) item() string {
+	if r.Movie.ImdbID != "" {
+		return fmt.Sprintf("line %d (%s)", r.Line, r.Movie.ImdbID)
+	}
+	return fmt.Sprintf("line %d", r.Line)
+}
@@ -0,0 +1,35 @@
+package catalog
+
+import (
+	"context"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const jobTimeout = time.Hour
+
+// Start imports the rows in a background job and returns it. It fails with
+// jobs.ErrRunning while another import runs.
+func Start(rows []Row, format string, dryRun bool, createdBy string, client *mongo.Client) (*models.Job, error) {
+	return jobs.Start(models.JobTypeCatalogImport, jobParams(rows, format, dryRun), createdBy, jobTimeout, client, importFunc(rows, format, dryRun, client))
+}
+
+// Run imports the rows in a job and waits for it to finish.
+func Run(rows []Row, format string, dryRun bool, createdBy string, client *mongo.Client) (*models.Job, error) {
+	return jobs.Run(models.JobTypeCatalogImport, jobParams(rows, format, dryRun), createdBy, jobTimeout, client, importFunc(rows, format, dryRun, client))
+}
+
+func jobParams(rows []Row, format string, dryRun bool) bson.M {
+	return bson.M{"format": format, "dry_run": dryRun, "rows": len(rows)}
+}
+
+func importFunc(rows []Row, format string, dryRun bool, client *mongo.Client) jobs.Func {
+	return func(ctx context.Context, tracker *jobs.Tracker) error {
+		_, err := Import(ctx, rows, format, dryRun, tracker, client)
+		return err
+	}
+}
@@ -0,0 +1,130 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// maxLineLength is the longest JSON Lines line accepted.
+const maxLineLength = 1 << 20
+
+// Row is a movie read from an import file, or why it could not be read.
+type Row struct {
+	Line  int // Where the row starts in the file, from 1
+	Movie models.Movie
+	Err   error
+
+	rankingGiven bool
+}
+
+// ReadRows reads all rows of a CSV or JSON Lines file. Rows that cannot be read are
+// returned with their error; the error returned is for files that cannot be read at all.
+func ReadRows(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case models.CatalogFormatCSV:
+		return readCSV(r)
+	case models.CatalogFormatJSONL:
+		return readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected csv or jsonl", format)
+	}
+}
+
+// readCSV reads a CSV file with a header naming its columns among Columns. Empty cells
+// are left empty.
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	columns := make([]*Column, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		j := slices.IndexFunc(Columns, func(c Column) bool { return c.Name == name })
+		if j < 0 {
+			return nil, fmt.Errorf("header: unknown column %q", name)
+		}
+		if slices.Contains(columns, &Columns[j]) {
+			return nil, fmt.Errorf("header: column %q is repeated", name)
+		}
+		columns[i] = &Columns[j]
+	}
+	for i := range Columns {
+		if Columns[i].Required && !slices.Contains(columns, &Columns[i]) {
+			return nil, fmt.Errorf("header: missing column %q", Columns[i].Name)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			// The reader goes on with the next record. FieldPos must not be called here:
+			// after a quoting error the record has no fields.
+			rows = append(rows, Row{Line: parseErr.StartLine, Err: err})
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+		for i, value := range record {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if err := columns[i].Set(&row.Movie, value); err != nil {
+				row.Err = err
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readJSONL reads one movie per line, in the JSON form of the API. Fields that are not
+// imported (user ratings, enrichment) are ignored.
+func readJSONL(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := Row{Line: line}
+		if err := json.Unmarshal([]byte(text), &row.Movie); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		row.Movie.ID = bson.ObjectID{}
+		row.Movie.UserRating = nil
+		row.Movie.Enrichment = nil
+		rows = append(rows, row)
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, fmt.Errorf("line %d is longer than %d bytes", len(rows)+1, maxLineLength)
+	}
+	return rows, scanner.Err()
+}
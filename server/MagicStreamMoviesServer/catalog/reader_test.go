@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+func TestReadCSVBadlyQuotedRow(t *testing.T) {
+	file := strings.Join([]string{
+		"imdb_id,title,poster_path,youtube_id,genres",
+		"tt0000001,First,/first.jpg,yt1,Drama",
+		`tt0000002,Bad "quote",/bad.jpg,yt2,Drama`,
+		"tt0000003,Third,/third.jpg,yt3,Comedy",
+	}, "\n")
+
+	rows, err := ReadRows(strings.NewReader(file), models.CatalogFormatCSV)
+	if err != nil {
+		t.Fatalf("ReadRows: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	var parseErr *csv.ParseError
+	if !errors.As(rows[1].Err, &parseErr) {
+		t.Fatalf("row 2 error = %v, want a csv.ParseError", rows[1].Err)
+	}
+	if rows[1].Line != 3 {
+		t.Errorf("row 2 line = %d, want 3", rows[1].Line)
+	}
+
+	for _, i := range []int{0, 2} {
+		if rows[i].Err != nil {
+			t.Errorf("row %d: unexpected error %v", i+1, rows[i].Err)
+		}
+	}
+	if rows[2].Line != 4 || rows[2].Movie.ImdbID != "tt0000003" {
+		t.Errorf("row 3 = line %d, imdb_id %q; want line 4, tt0000003", rows[2].Line, rows[2].Movie.ImdbID)
+	}
+}
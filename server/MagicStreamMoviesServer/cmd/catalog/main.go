@@ -0,0 +1,168 @@
+// Command catalog imports and exports the movie catalog from the command line.
+//
+// Usage:
+//
+//	catalog import [-format csv|jsonl] [-dry-run] <file>
+//	catalog export [-format jsonl|csv|json] [-fields f1,f2] [-filter query] [-o file]
+//
+// It connects to the database configured by the .env file of the working directory.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/catalog"
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+)
+
+const usage = `Usage:
+  catalog import [-format csv|jsonl] [-dry-run] <file>
+  catalog export [-format jsonl|csv|json] [-fields f1,f2] [-filter query] [-o file]
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "catalog:", err)
+		os.Exit(1)
+	}
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "file format, csv or jsonl (default: from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "check the file and count changes without writing")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		if *format = formatOf(path); *format == "" || *format == models.CatalogFormatJSON {
+			return fmt.Errorf("cannot import %s, use -format csv or jsonl", path)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	rows, err := catalog.ReadRows(file, *format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	client := database.Connect()
+	defer client.Disconnect(context.Background())
+
+	job, err := catalog.Run(rows, *format, *dryRun, "cli", client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Job %s %s\n", job.JobID, job.Status)
+	if job.Result != nil {
+		fmt.Printf("Rows: %v, inserted: %v, updated: %v, failed: %v, dry run: %v\n",
+			job.Result["rows"], job.Result["inserted"], job.Result["updated"], job.Result["failed"], job.Result["dry_run"])
+	}
+	for _, jobErr := range job.Errors {
+		fmt.Printf("  %s: %s\n", jobErr.Item, jobErr.Message)
+	}
+	if job.Progress.Failed > int64(len(job.Errors)) {
+		fmt.Printf("  ... and %d more errors\n", job.Progress.Failed-int64(len(job.Errors)))
+	}
+	if job.Status != models.JobSucceeded {
+		return fmt.Errorf("the import failed: %s", job.Error)
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "file format, jsonl, csv or json (default: from -o, else jsonl)")
+	fields := flags.String("fields", "", "comma separated fields to export (default: all)")
+	filterQuery := flags.String("filter", "", "movie filters as in GET /movies, e.g. genre=Comedy&year_from=1990")
+	output := flags.String("o", "", "file to write (default: standard output)")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		if *format = formatOf(*output); *format == "" {
+			*format = models.CatalogFormatJSONL
+		}
+	}
+	columns, err := catalog.ParseFields(*fields)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(*filterQuery)
+	if err != nil {
+		return fmt.Errorf("-filter: %w", err)
+	}
+	filter, err := utils.MovieFilter(values)
+	if err != nil {
+		return fmt.Errorf("-filter: %w", err)
+	}
+
+	client := database.Connect()
+	defer client.Disconnect(context.Background())
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+	}
+	count, err := catalog.Export(context.Background(), out, *format, columns, filter, client)
+	if out != os.Stdout {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d movies\n", count)
+	return nil
+}
+
+// formatOf tells the format of a catalog file from its extension, or returns "".
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return models.CatalogFormatCSV
+	case ".jsonl", ".ndjson":
+		return models.CatalogFormatJSONL
+	case ".json":
+		return models.CatalogFormatJSON
+	}
+	return ""
+}
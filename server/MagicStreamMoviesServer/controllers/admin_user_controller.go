@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// adminUserProjection keeps credentials out of admin responses, on top of the json:"-" tags.
+var adminUserProjection = bson.M{
+	"password":            0,
+	"sessions":            0,
+	"totp_secret":         0,
+	"totp_pending_secret": 0,
+	"recovery_codes":      0,
+}
+
+// ListUsers returns a page of users, newest first.
+// ?q= searches email, first and last name (case-insensitive), ?role= and ?disabled= filter.
+func ListUsers(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			pattern := bson.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+			filter["$or"] = bson.A{
+				bson.M{"email": pattern},
+				bson.M{"first_name": pattern},
+				bson.M{"last_name": pattern},
+			}
+		}
+		if role := c.Query("role"); role != "" {
+			if role != models.RoleAdmin && role != models.RoleUser {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "role must be ADMIN or USER"})
+				return
+			}
+			filter["role"] = role
+		}
+		switch c.Query("disabled") {
+		case "":
+		case "true":
+			filter["disabled"] = true
+		case "false":
+			filter["disabled"] = bson.M{"$ne": true}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "disabled must be true or false"})
+			return
+		}
+
+		users := database.OpenCollection("users", client)
+
+		total, err := users.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count users"})
+			return
+		}
+
+		opts := options.Find().
+			SetProjection(adminUserProjection).
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip((page - 1) * pageSize).
+			SetLimit(pageSize)
+		cursor, err := users.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch users"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		result := models.UserPage{Users: []models.User{}, Page: page, PageSize: pageSize, Total: total}
+		if err = cursor.All(ctx, &result.Users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode users"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetUser returns a single user, without credentials.
+func GetUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var user models.User
+		opts := options.FindOne().SetProjection(adminUserProjection)
+		err := database.OpenCollection("users", client).FindOne(ctx, bson.M{"user_id": c.Param("user_id")}, opts).Decode(&user)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// DisableUser blocks an account: its sessions are ended, it cannot log in and its API keys stop working.
+// Admins cannot disable themselves or the last enabled admin.
+func DisableUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.UserDisableRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		if targetID == adminID {
+			c.JSON(http.StatusConflict, gin.H{"Error": "You cannot disable your own account"})
+			return
+		}
+
+		users := database.OpenCollection("users", client)
+
+		var target models.User
+		if err := users.FindOne(ctx, bson.M{"user_id": targetID}).Decode(&target); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+		if target.Disabled {
+			c.JSON(http.StatusOK, gin.H{"message": "User already disabled", "user_id": targetID})
+			return
+		}
+
+		if target.Role == models.RoleAdmin {
+			admins, err := users.CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count admins"})
+				return
+			}
+			if admins <= 1 {
+				c.JSON(http.StatusConflict, gin.H{"Error": "Cannot disable the last admin"})
+				return
+			}
+		}
+
+		now := time.Now()
+		update := bson.M{"$set": bson.M{
+			"disabled":        true,
+			"disabled_at":     now,
+			"disabled_reason": req.Reason,
+			"sessions":        bson.A{},
+			"updated_at":      now,
+		}}
+		if _, err := users.UpdateOne(ctx, bson.M{"user_id": targetID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to disable user"})
+			return
+		}
+
+		if err := utils.RecordAudit(adminID, models.AuditActionDisable, targetID, bson.M{"reason": req.Reason}, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User disabled", "user_id": targetID})
+	}
+}
+
+// EnableUser lifts a DisableUser. The user has to log in again.
+func EnableUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		update := bson.M{
+			"$set":   bson.M{"updated_at": time.Now()},
+			"$unset": bson.M{"disabled": "", "disabled_at": "", "disabled_reason": ""},
+		}
+		result, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": targetID, "disabled": true}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to enable user"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			count, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"user_id": targetID})
+			if err == nil && count == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "User already enabled", "user_id": targetID})
+			return
+		}
+
+		if err := utils.RecordAudit(adminID, models.AuditActionEnable, targetID, nil, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User enabled", "user_id": targetID})
+	}
+}
+
+// ForceLogoutUser ends every session of a user. Their API keys are not affected.
+func ForceLogoutUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		count, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"user_id": targetID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+			return
+		}
+
+		if err := utils.RevokeUserSessions(targetID, client, c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to end the user's sessions"})
+			return
+		}
+
+		if err := utils.RecordAudit(adminID, models.AuditActionForceLogout, targetID, nil, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User logged out", "user_id": targetID})
+	}
+}
+
+// UpdateUserRole promotes or demotes a user. Every change is written to the audit log
+// together with the reason given by the admin, and the user's sessions are ended so
+// that the new role (embedded in the JWT) takes effect immediately.
+func UpdateUserRole(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.RoleUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		users := database.OpenCollection("users", client)
+
+		var target models.User
+		if err := users.FindOne(ctx, bson.M{"user_id": targetID}).Decode(&target); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+
+		if target.Role == req.Role {
+			c.JSON(http.StatusOK, gin.H{"message": "Role unchanged", "user_id": targetID, "role": req.Role})
+			return
+		}
+
+		// Never leave the platform without an admin (disabled admins do not count)
+		if target.Role == models.RoleAdmin {
+			admins, err := users.CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count admins"})
+				return
+			}
+			if admins <= 1 {
+				c.JSON(http.StatusConflict, gin.H{"Error": "Cannot demote the last admin"})
+				return
+			}
+		}
+
+		update := bson.M{"$set": bson.M{"role": req.Role, "updated_at": time.Now()}}
+		if _, err := users.UpdateOne(ctx, bson.M{"user_id": targetID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update role"})
+			return
+		}
+
+		details := bson.M{"from": target.Role, "to": req.Role, "reason": req.Reason}
+		if err := utils.RecordAudit(adminID, models.AuditActionRoleChange, targetID, details, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+
+		if err := utils.RevokeUserSessions(targetID, client, c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Role updated but failed to end the user's sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Role updated", "user_id": targetID, "role": req.Role})
+	}
+}
+
+// UnlockUser clears the failed login attempts of a user, lifting any lockout on the account.
+// Lockouts of IP addresses are left alone; they expire on their own.
+func UnlockUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		var target models.User
+		err = database.OpenCollection("users", client).FindOne(ctx, bson.M{"user_id": targetID}).Decode(&target)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+
+		accountKey, _ := utils.LoginAttemptKeys(target.Email, c)
+		if err := utils.ResetLoginFailures(accountKey, client, c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to unlock user"})
+			return
+		}
+
+		if err := utils.RecordAudit(adminID, models.AuditActionUnlock, targetID, nil, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User unlocked", "user_id": targetID})
+	}
+}
+
+// BootstrapAdmin makes sure the platform has a first admin.
+//
+// It does nothing if an enabled admin already exists or BOOTSTRAP_ADMIN_EMAIL is not set.
+// Otherwise the user with that email is promoted if their email is verified, or created with
+// BOOTSTRAP_ADMIN_PASSWORD (and optionally BOOTSTRAP_ADMIN_FIRST_NAME/LAST_NAME)
+// if it does not exist yet. The change is recorded in the audit log.
+func BootstrapAdmin(client *mongo.Client) error {
+	email := utils.NormalizeEmail(os.Getenv("BOOTSTRAP_ADMIN_EMAIL"))
+	if email == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	users := database.OpenCollection("users", client)
+
+	// Disabled admins do not count, so that disabling the only admin can be recovered from
+	admins, err := users.CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	var existing models.User
+	err = users.FindOne(ctx, bson.M{"email": email}).Decode(&existing)
+	switch {
+	case err == nil:
+		// Anyone could have registered the address first; only its verified owner is trusted
+		if !existing.EmailVerified {
+			log.Println("Bootstrap: not promoting", email, "to ADMIN because its email address is not verified")
+			return nil
+		}
+		update := bson.M{"$set": bson.M{"role": models.RoleAdmin, "updated_at": time.Now()}}
+		if _, err := users.UpdateOne(ctx, bson.M{"user_id": existing.UserID}, update); err != nil {
+			return err
+		}
+		log.Println("Bootstrap: promoted", email, "to ADMIN")
+		details := bson.M{"from": existing.Role, "to": models.RoleAdmin, "reason": "bootstrap"}
+		return utils.RecordAudit("bootstrap", models.AuditActionRoleChange, existing.UserID, details, client, ctx)
+
+	case errors.Is(err, mongo.ErrNoDocuments):
+		password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+		if len(password) < 6 {
+			return errors.New("BOOTSTRAP_ADMIN_PASSWORD must be set (at least 6 characters) to create the first admin")
+		}
+		hashedPassword, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		firstName := os.Getenv("BOOTSTRAP_ADMIN_FIRST_NAME")
+		if firstName == "" {
+			firstName = "Admin"
+		}
+		lastName := os.Getenv("BOOTSTRAP_ADMIN_LAST_NAME")
+		if lastName == "" {
+			lastName = "MagicStream"
+		}
+
+		now := time.Now()
+		admin := models.User{
+			UserID:          bson.NewObjectID().Hex(),
+			FirstName:       firstName,
+			LastName:        lastName,
+			Email:           email,
+			Password:        hashedPassword,
+			Role:            models.RoleAdmin,
+			EmailVerified:   true, // Set by the operator, there is nobody to send the link to
+			EmailVerifiedAt: &now,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			FavoriteGenres:  []models.Genre{},
+			SchemaVersion:   models.UserSchemaVersion,
+		}
+		if _, err := users.InsertOne(ctx, admin); err != nil {
+			return err
+		}
+		log.Println("Bootstrap: created admin", email)
+		details := bson.M{"from": "", "to": models.RoleAdmin, "reason": "bootstrap"}
+		return utils.RecordAudit("bootstrap", models.AuditActionRoleChange, admin.UserID, details, client, ctx)
+
+	default:
+		return err
+	}
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// defaultAPIKeyLifetimeDays is used when the request does not specify an expiry.
+const defaultAPIKeyLifetimeDays = 90
+
+// CreateAPIKey issues a new API key for the current user.
+// Admins can pass a user_id to create a key on behalf of another account (e.g. a service account).
+// The plain key is returned once and never stored.
+func CreateAPIKey(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+		role, err := utils.GetUserRoleFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "user role not found"})
+			return
+		}
+
+		// Admin keys carry the admin role, so they must not be a way around two-factor authentication
+		if role == models.RoleAdmin && utils.IsAdminMFARequired() && !utils.GetMFAFromContext(c) {
+			c.JSON(http.StatusForbidden, gin.H{"Error": "Two-factor authentication is required for admins to create API keys"})
+			return
+		}
+
+		var req models.APIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		ownerID := userID
+		if req.UserID != "" && req.UserID != userID {
+			if role != "ADMIN" {
+				c.JSON(http.StatusForbidden, gin.H{"Error": "Only admins can create API keys for other users"})
+				return
+			}
+
+			count, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"user_id": req.UserID})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check user"})
+				return
+			}
+			if count == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			ownerID = req.UserID
+		}
+
+		expiresInDays := req.ExpiresInDays
+		if expiresInDays == 0 {
+			expiresInDays = defaultAPIKeyLifetimeDays
+		}
+
+		key, hash, err := utils.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate API key"})
+			return
+		}
+
+		now := time.Now()
+		apiKey := models.APIKey{
+			KeyID:     bson.NewObjectID().Hex(),
+			UserID:    ownerID,
+			CreatedBy: userID,
+			Name:      req.Name,
+			Prefix:    key[:len(utils.APIKeyPrefix)+6],
+			KeyHash:   hash,
+			Scopes:    req.Scopes,
+			MFA:       utils.GetMFAFromContext(c),
+			CreatedAt: now,
+			ExpiresAt: now.AddDate(0, 0, expiresInDays),
+		}
+
+		if _, err := database.OpenCollection("api_keys", client).InsertOne(ctx, apiKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to store API key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, models.APIKeyResponse{APIKey: apiKey, Key: key})
+	}
+}
+
+// ListAPIKeys returns the current user's API keys, most recent first.
+// Admins can list another user's keys with ?user_id=.
+func ListAPIKeys(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+		role, err := utils.GetUserRoleFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "user role not found"})
+			return
+		}
+
+		ownerID := userID
+		if requested := c.Query("user_id"); requested != "" && requested != userID {
+			if role != "ADMIN" {
+				c.JSON(http.StatusForbidden, gin.H{"Error": "Only admins can list API keys of other users"})
+				return
+			}
+			ownerID = requested
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		cursor, err := database.OpenCollection("api_keys", client).Find(ctx, bson.M{"user_id": ownerID}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch API keys"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		apiKeys := []models.APIKey{}
+		if err = cursor.All(ctx, &apiKeys); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, apiKeys)
+	}
+}
+
+// RevokeAPIKey revokes one of the current user's keys. Admins can revoke any key.
+// Revoked keys are kept so that their last use stays visible.
+func RevokeAPIKey(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+		role, err := utils.GetUserRoleFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "user role not found"})
+			return
+		}
+
+		filter := bson.M{"key_id": c.Param("key_id"), "revoked_at": bson.M{"$exists": false}}
+		if role != "ADMIN" {
+			filter["user_id"] = userID
+		}
+
+		result, err := database.OpenCollection("api_keys", client).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to revoke API key"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "API key not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/discovery"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const defaultDiscoveryLimit = 20
+
+// DiscoverMovies finds movies from a natural language query. The response includes the
+// filter the query was understood as and whether it came from the model or keywords.
+func DiscoverMovies(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.DiscoveryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		req.Query = strings.TrimSpace(req.Query)
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+		if req.Limit == 0 {
+			req.Limit = defaultDiscoveryLimit
+		}
+
+		response, err := discovery.Discover(ctx, req.Query, req.Limit, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to discover movies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/embedding"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// defaultSimilarLimit is the number of movies returned by GetSimilarMovies by default.
+const defaultSimilarLimit = 10
+
+// GetSimilarMovies returns the movies closest to a movie by content (title, genres and
+// admin review), most similar first. ?limit= sets the number of movies (default 10, max 50).
+func GetSimilarMovies(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		limit := defaultSimilarLimit
+		if value := c.Query("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "limit must be between 1 and 50"})
+				return
+			}
+		}
+
+		movies := database.OpenCollection("movies", client)
+		var movie models.Movie
+		if err := movies.FindOne(ctx, bson.M{"imdb_id": c.Param("imdb_id")}).Decode(&movie); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch movie"})
+			return
+		}
+
+		matches, err := embedding.Similar(ctx, &movie, limit, client)
+		if err != nil {
+			log.Println("Similar movies failed for", movie.ImdbID, ":", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"Error": "Similar movies are not available right now"})
+			return
+		}
+
+		imdbIDs := make([]string, 0, len(matches))
+		for _, match := range matches {
+			imdbIDs = append(imdbIDs, match.ImdbID)
+		}
+		cursor, err := movies.Find(ctx, bson.M{"imdb_id": bson.M{"$in": imdbIDs}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch movies"})
+			return
+		}
+		var found []models.Movie
+		if err := cursor.All(ctx, &found); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode movies"})
+			return
+		}
+		byID := make(map[string]models.Movie, len(found))
+		for _, m := range found {
+			byID[m.ImdbID] = m
+		}
+
+		similar := make([]models.SimilarMovie, 0, len(matches))
+		for _, match := range matches {
+			// Movies deleted since the last rebuild are skipped
+			if m, ok := byID[match.ImdbID]; ok {
+				similar = append(similar, models.SimilarMovie{Movie: m, Similarity: match.Similarity})
+			}
+		}
+
+		c.JSON(http.StatusOK, similar)
+	}
+}
+
+// RebuildEmbeddings starts recomputing movie vectors in the background. Only movies whose
+// text changed are embedded again, unless ?force=true.
+func RebuildEmbeddings(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		force := c.Query("force") == "true"
+
+		if err := embedding.StartRebuild(force, client); err != nil {
+			if errors.Is(err, embedding.ErrRebuildRunning) {
+				c.JSON(http.StatusConflict, gin.H{"Error": "A rebuild is already running"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start rebuild"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Rebuild started", "model": embedding.Default().Model()})
+	}
+}
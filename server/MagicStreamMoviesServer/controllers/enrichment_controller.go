@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/enrichment"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// RunEnrichment starts the job generating synopses, mood tags and content warnings.
+// The body is optional: without imdb_ids the whole catalog is processed.
+func RunEnrichment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.EnrichmentRunRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+				return
+			}
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		job, err := enrichment.Start(req, adminID, client)
+		if errors.Is(err, jobs.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"Error": "An enrichment job is already running"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start enrichment"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// EditMovieEnrichment changes the synopsis, mood tags or content warnings of a movie,
+// or locks them against the enrichment job.
+func EditMovieEnrichment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.EnrichmentEditRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		result, err := enrichment.Edit(ctx, c.Param("imdb_id"), req, adminID, client)
+		switch {
+		case errors.Is(err, enrichment.ErrInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update enrichment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/experiments"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ListExperiments returns the experiments, newest first. ?status= filters on draft, running or stopped.
+func ListExperiments(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			switch status {
+			case models.ExperimentDraft, models.ExperimentRunning, models.ExperimentStopped:
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "status must be one of draft, running, stopped"})
+				return
+			}
+			filter["status"] = status
+		}
+
+		collection := database.OpenCollection("experiments", client)
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count experiments"})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip((page - 1) * pageSize).
+			SetLimit(pageSize)
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch experiments"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		items := []models.Experiment{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode experiments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ExperimentPage{Items: items, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// CreateExperiment saves a draft experiment. Each variant names a recommendation strategy.
+func CreateExperiment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.ExperimentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		req.Description = strings.TrimSpace(req.Description)
+		for i := range req.Variants {
+			req.Variants[i].Name = strings.TrimSpace(req.Variants[i].Name)
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		experiment, err := experiments.Create(ctx, req, adminID, client)
+		if errors.Is(err, experiments.ErrInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create experiment"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, experiment)
+	}
+}
+
+// GetExperiment returns one experiment.
+func GetExperiment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		experiment, err := experiments.Get(ctx, c.Param("experiment_id"), client)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Experiment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch experiment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, experiment)
+	}
+}
+
+// StartExperiment runs a draft experiment. Only one experiment runs at a time.
+func StartExperiment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeExperimentStatus(c, true, client)
+	}
+}
+
+// StopExperiment ends a running experiment. Users get the default strategy again.
+func StopExperiment(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeExperimentStatus(c, false, client)
+	}
+}
+
+func changeExperimentStatus(c *gin.Context, start bool, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	adminID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	change, action := experiments.Stop, models.AuditActionExperimentStop
+	if start {
+		change, action = experiments.Start, models.AuditActionExperimentStart
+	}
+	experiment, err := change(ctx, c.Param("experiment_id"), client)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Experiment not found"})
+		case errors.Is(err, experiments.ErrAlreadyRunning):
+			c.JSON(http.StatusConflict, gin.H{"Error": "Another experiment is running"})
+		case errors.Is(err, experiments.ErrWrongStatus) && start:
+			c.JSON(http.StatusConflict, gin.H{"Error": "Only draft experiments can be started"})
+		case errors.Is(err, experiments.ErrWrongStatus):
+			c.JSON(http.StatusConflict, gin.H{"Error": "Experiment is not running"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update experiment"})
+		}
+		return
+	}
+
+	if err := utils.RecordAudit(adminID, action, experiment.ExperimentID, bson.M{"name": experiment.Name}, client, ctx); err != nil {
+		log.Println("Failed to write audit log:", err)
+	}
+
+	c.JSON(http.StatusOK, experiment)
+}
+
+// GetExperimentReport returns the CTR and watch-through of each variant with their
+// confidence intervals. It can be read while the experiment runs.
+func GetExperimentReport(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		experiment, err := experiments.Get(ctx, c.Param("experiment_id"), client)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Experiment not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch experiment"})
+			return
+		}
+
+		report, err := experiments.Report(ctx, experiment, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to compute report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// RecordRecommendationClick is called by the client when the user opens a recommended movie.
+// The click goes to the latest impression of the movie, if it was recommended recently
+// during an experiment.
+func RecordRecommendationClick(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		recorded, err := experiments.RecordClick(ctx, userID, c.Param("imdb_id"), client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to record click"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"recorded": recorded})
+	}
+}
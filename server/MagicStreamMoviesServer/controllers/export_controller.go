@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/catalog"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// exportTimeout bounds a catalog export, which lasts as long as the client takes to read it.
+const exportTimeout = 10 * time.Minute
+
+var exportContentTypes = map[string]string{
+	models.CatalogFormatJSONL: "application/x-ndjson",
+	models.CatalogFormatCSV:   "text/csv; charset=utf-8",
+	models.CatalogFormatJSON:  "application/json; charset=utf-8",
+}
+
+// ExportMovies streams the catalog as a file download. ?format= picks jsonl (the
+// default), csv or json, ?fields= a comma separated list of fields, and the filters of
+// GET /movies select the movies. Movies are written as they are read from the database,
+// so an error half way ends the download early and is only logged.
+func ExportMovies(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), exportTimeout)
+		defer cancel()
+
+		format := strings.ToLower(c.DefaultQuery("format", models.CatalogFormatJSONL))
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "format must be jsonl, csv or json"})
+			return
+		}
+		columns, err := catalog.ParseFields(c.Query("fields"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		filter, err := utils.MovieFilter(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		filename := "magicstream-movies-" + time.Now().UTC().Format("20060102") + "." + format
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		count, err := catalog.Export(ctx, c.Writer, format, columns, filter, client)
+		if err != nil {
+			log.Printf("Catalog export failed after %d movies: %v", count, err)
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Disposition")
+				c.Writer.Header().Del("Content-Type")
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to export movies"})
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/catalog"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// maxImportSize is the largest catalog file accepted, in bytes.
+const maxImportSize = 50 << 20
+
+// ImportMovies starts a job upserting the movies of a CSV or JSON Lines file into the
+// catalog. The file is sent as the "file" field of a multipart form or as the raw body.
+// The format comes from ?format=csv|jsonl, or else from the file name or content type.
+// With ?dry_run=true the rows are checked and counted but nothing is written.
+func ImportMovies(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		dryRun := false
+		if raw := c.Query("dry_run"); raw != "" {
+			if dryRun, err = strconv.ParseBool(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "dry_run must be true or false"})
+				return
+			}
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		body, fileName, contentType := io.Reader(c.Request.Body), "", c.ContentType()
+		if strings.HasPrefix(contentType, "multipart/") {
+			header, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "A file field is required", "details": err.Error()})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to read the file"})
+				return
+			}
+			defer file.Close()
+			body, fileName, contentType = file, header.Filename, header.Header.Get("Content-Type")
+		}
+
+		format := importFormat(c.Query("format"), fileName, contentType)
+		if format == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Unknown file format, use ?format=csv or ?format=jsonl"})
+			return
+		}
+
+		rows, err := catalog.ReadRows(body, format)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"Error": "The file is larger than 50 MiB"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid file", "details": err.Error()})
+			return
+		}
+		if len(rows) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "The file has no movies"})
+			return
+		}
+
+		job, err := catalog.Start(rows, format, dryRun, adminID, client)
+		if errors.Is(err, jobs.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"Error": "A catalog import is already running"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start the import"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// importFormat picks the format of an imported file, or returns "" when it is unknown.
+func importFormat(requested, fileName, contentType string) string {
+	switch strings.ToLower(requested) {
+	case models.CatalogFormatCSV, models.CatalogFormatJSONL:
+		return strings.ToLower(requested)
+	case "":
+	default:
+		return ""
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return models.CatalogFormatCSV
+	case ".jsonl", ".ndjson":
+		return models.CatalogFormatJSONL
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return models.CatalogFormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return models.CatalogFormatJSONL
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ListJobs returns background jobs, newest first, without their error reports.
+// ?type= and ?status= filter them.
+func ListJobs(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if jobType := c.Query("type"); jobType != "" {
+			filter["type"] = jobType
+		}
+		if status := c.Query("status"); status != "" {
+			switch status {
+			case models.JobRunning, models.JobSucceeded, models.JobFailed:
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "status must be one of running, succeeded, failed"})
+				return
+			}
+			filter["status"] = status
+		}
+
+		collection := database.OpenCollection("jobs", client)
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count jobs"})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip((page - 1) * pageSize).
+			SetLimit(pageSize).
+			SetProjection(bson.M{"errors": 0})
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch jobs"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		items := []models.Job{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode jobs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.JobPage{Items: items, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// GetJob returns a job with its progress and error report.
+func GetJob(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		job, err := jobs.Get(ctx, c.Param("job_id"), client)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch job"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
@@ -0,0 +1,554 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// maxListsPerUser caps the number of custom lists (the watchlist does not count).
+	maxListsPerUser = 50
+	// maxListItems caps the number of movies in a list.
+	maxListItems = 1000
+)
+
+// watchlistAlias can be used instead of a list ID to address the user's watchlist.
+const watchlistAlias = "watchlist"
+
+// GetMyLists returns the user's watchlist followed by their custom lists, oldest first.
+func GetMyLists(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		if err := ensureWatchlist(ctx, userID, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create watchlist"})
+			return
+		}
+
+		// "custom" sorts after "watchlist" in descending order
+		opts := options.Find().SetSort(bson.D{{Key: "kind", Value: -1}, {Key: "created_at", Value: 1}})
+		cursor, err := database.OpenCollection("user_lists", client).Find(ctx, bson.M{"user_id": userID}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch lists"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		lists := []models.UserList{}
+		if err := cursor.All(ctx, &lists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode lists"})
+			return
+		}
+		for i := range lists {
+			lists[i].Shared = lists[i].ShareTokenHash != ""
+		}
+
+		c.JSON(http.StatusOK, lists)
+	}
+}
+
+// CreateList creates a custom list. Lists are private unless created with "visibility": "public".
+func CreateList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.ListCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		lists := database.OpenCollection("user_lists", client)
+		count, err := lists.CountDocuments(ctx, bson.M{"user_id": userID, "kind": models.ListKindCustom})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count lists"})
+			return
+		}
+		if count >= maxListsPerUser {
+			c.JSON(http.StatusConflict, gin.H{"Error": fmt.Sprintf("You can have at most %d lists", maxListsPerUser)})
+			return
+		}
+
+		visibility := req.Visibility
+		if visibility == "" {
+			visibility = models.ListVisibilityPrivate
+		}
+
+		now := time.Now()
+		list := models.UserList{
+			ListID:     bson.NewObjectID().Hex(),
+			UserID:     userID,
+			Name:       req.Name,
+			Kind:       models.ListKindCustom,
+			Visibility: visibility,
+			Items:      []models.ListItem{},
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if _, err := lists.InsertOne(ctx, list); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create list"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, list)
+	}
+}
+
+// GetMyList returns one of the user's lists with the title and poster of each movie.
+func GetMyList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+		if err := attachMovieSummaries(ctx, list.Items, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch movies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// UpdateList renames a custom list and/or changes the visibility of any list.
+func UpdateList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.ListUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if req.Name != nil {
+			if list.Kind == models.ListKindWatchlist {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "The watchlist cannot be renamed"})
+				return
+			}
+			set["name"] = *req.Name
+		}
+		if req.Visibility != nil {
+			set["visibility"] = *req.Visibility
+		}
+
+		var updated models.UserList
+		err := database.OpenCollection("user_lists", client).FindOneAndUpdate(ctx,
+			bson.M{"list_id": list.ListID},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update list"})
+			return
+		}
+		updated.Shared = updated.ShareTokenHash != ""
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteList deletes a custom list. The watchlist can be emptied but not deleted.
+func DeleteList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+		if list.Kind == models.ListKindWatchlist {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "The watchlist cannot be deleted"})
+			return
+		}
+
+		if _, err := database.OpenCollection("user_lists", client).DeleteOne(ctx, bson.M{"list_id": list.ListID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete list"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "List deleted"})
+	}
+}
+
+// AddListItem appends a movie to a list. Adding a movie that is already in the list does nothing.
+func AddListItem(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.ListItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		exists, err := movieExists(req.ImdbID, client, ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+			return
+		}
+
+		now := time.Now()
+		// Both conditions are checked in the same write, so concurrent adds cannot
+		// create duplicates or go over the limit
+		filter := bson.M{
+			"list_id":                               list.ListID,
+			"items.imdb_id":                         bson.M{"$ne": req.ImdbID},
+			fmt.Sprintf("items.%d", maxListItems-1): bson.M{"$exists": false},
+		}
+		update := bson.M{
+			"$push": bson.M{"items": models.ListItem{ImdbID: req.ImdbID, AddedAt: now}},
+			"$set":  bson.M{"updated_at": now},
+		}
+		result, err := database.OpenCollection("user_lists", client).UpdateOne(ctx, filter, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to add movie"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			for _, item := range list.Items {
+				if item.ImdbID == req.ImdbID {
+					c.JSON(http.StatusOK, gin.H{"message": "Movie already in list"})
+					return
+				}
+			}
+			c.JSON(http.StatusConflict, gin.H{"Error": fmt.Sprintf("A list can hold at most %d movies", maxListItems)})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Movie added"})
+	}
+}
+
+// RemoveListItem removes a movie from a list.
+func RemoveListItem(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		imdbID := c.Param("imdb_id")
+		result, err := database.OpenCollection("user_lists", client).UpdateOne(ctx,
+			bson.M{"list_id": list.ListID, "items.imdb_id": imdbID},
+			bson.M{"$pull": bson.M{"items": bson.M{"imdb_id": imdbID}}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to remove movie"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not in list"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Movie removed"})
+	}
+}
+
+// ReorderListItems puts the movies of a list in the given order. The request must list
+// exactly the movies in the list; if the list changed in the meantime it answers 409.
+func ReorderListItems(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.ListReorderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		current := make(map[string]models.ListItem, len(list.Items))
+		for _, item := range list.Items {
+			current[item.ImdbID] = item
+		}
+		if len(req.ImdbIDs) != len(current) {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "imdb_ids must contain every movie of the list exactly once"})
+			return
+		}
+
+		items := make([]models.ListItem, 0, len(req.ImdbIDs))
+		for _, imdbID := range req.ImdbIDs {
+			item, found := current[imdbID]
+			if !found {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "imdb_ids must contain every movie of the list exactly once"})
+				return
+			}
+			delete(current, imdbID) // Catches duplicates
+			items = append(items, item)
+		}
+
+		result, err := database.OpenCollection("user_lists", client).UpdateOne(ctx,
+			bson.M{"list_id": list.ListID, "updated_at": list.UpdatedAt},
+			bson.M{"$set": bson.M{"items": items, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to reorder list"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"Error": "The list changed, please reload it"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "List reordered"})
+	}
+}
+
+// ShareList creates a read-only share link for a list, replacing any previous one.
+// The token is returned once; only its hash is stored.
+func ShareList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		token, hash, err := utils.GenerateShareToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate share link"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{"share_token_hash": hash, "updated_at": time.Now()}}
+		if _, err := database.OpenCollection("user_lists", client).UpdateOne(ctx, bson.M{"list_id": list.ListID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to share list"})
+			return
+		}
+
+		shareURL := os.Getenv("LIST_SHARE_URL")
+		if shareURL == "" {
+			shareURL = "https://localhost:5173/shared/lists/"
+		}
+		c.JSON(http.StatusCreated, gin.H{"share_token": token, "share_url": shareURL + url.PathEscape(token)})
+	}
+}
+
+// UnshareList revokes the share link of a list.
+func UnshareList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		list, ok := findOwnList(ctx, client, c)
+		if !ok {
+			return
+		}
+
+		update := bson.M{"$unset": bson.M{"share_token_hash": ""}, "$set": bson.M{"updated_at": time.Now()}}
+		if _, err := database.OpenCollection("user_lists", client).UpdateOne(ctx, bson.M{"list_id": list.ListID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to revoke share link"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Share link revoked"})
+	}
+}
+
+// GetPublicList returns a public list. Private lists answer 404, as if they did not exist.
+func GetPublicList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sendPublicList(c, bson.M{"list_id": c.Param("list_id"), "visibility": models.ListVisibilityPublic}, client)
+	}
+}
+
+// GetSharedList returns the list behind a share link, whatever its visibility.
+func GetSharedList(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sendPublicList(c, bson.M{"share_token_hash": utils.HashShareToken(c.Param("share_token"))}, client)
+	}
+}
+
+func sendPublicList(c *gin.Context, filter bson.M, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	var list models.UserList
+	if err := database.OpenCollection("user_lists", client).FindOne(ctx, filter).Decode(&list); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "List not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch list"})
+		return
+	}
+	if err := attachMovieSummaries(ctx, list.Items, client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch movies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PublicUserList{
+		ListID:    list.ListID,
+		Name:      list.Name,
+		Kind:      list.Kind,
+		Items:     list.Items,
+		UpdatedAt: list.UpdatedAt,
+	})
+}
+
+// findOwnList loads the list named by :list_id ("watchlist" for the watchlist) if it
+// belongs to the current user. On failure it writes the error response and returns false.
+func findOwnList(ctx context.Context, client *mongo.Client, c *gin.Context) (*models.UserList, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return nil, false
+	}
+
+	filter := bson.M{"user_id": userID, "list_id": c.Param("list_id")}
+	if c.Param("list_id") == watchlistAlias {
+		if err := ensureWatchlist(ctx, userID, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to create watchlist"})
+			return nil, false
+		}
+		filter = bson.M{"user_id": userID, "kind": models.ListKindWatchlist}
+	}
+
+	var list models.UserList
+	if err := database.OpenCollection("user_lists", client).FindOne(ctx, filter).Decode(&list); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "List not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch list"})
+		return nil, false
+	}
+	list.Shared = list.ShareTokenHash != ""
+	return &list, true
+}
+
+// ensureWatchlist creates the user's watchlist if it does not exist yet.
+func ensureWatchlist(ctx context.Context, userID string, client *mongo.Client) error {
+	now := time.Now()
+	_, err := database.OpenCollection("user_lists", client).UpdateOne(ctx,
+		bson.M{"user_id": userID, "kind": models.ListKindWatchlist},
+		bson.M{"$setOnInsert": bson.M{
+			"list_id":    bson.NewObjectID().Hex(),
+			"name":       "Watchlist",
+			"visibility": models.ListVisibilityPrivate,
+			"items":      bson.A{},
+			"created_at": now,
+			"updated_at": now,
+		}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil // Created by a concurrent request
+	}
+	return err
+}
+
+// attachMovieSummaries fills in the title and poster of each item. Movies that were
+// removed from the catalogue keep their item, without a summary.
+func attachMovieSummaries(ctx context.Context, items []models.ListItem, client *mongo.Client) error {
+	if len(items) == 0 {
+		return nil
+	}
+	imdbIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		imdbIDs = append(imdbIDs, item.ImdbID)
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 0, "imdb_id": 1, "title": 1, "poster_path": 1, "youtube_id": 1})
+	cursor, err := database.OpenCollection("movies", client).Find(ctx, bson.M{"imdb_id": bson.M{"$in": imdbIDs}}, opts)
+	if err != nil {
+		return err
+	}
+
+	var movies []struct {
+		ImdbID              string `bson:"imdb_id"`
+		models.MovieSummary `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &movies); err != nil {
+		return err
+	}
+
+	summaries := make(map[string]models.MovieSummary, len(movies))
+	for _, movie := range movies {
+		summaries[movie.ImdbID] = movie.MovieSummary
+	}
+	for i := range items {
+		if summary, ok := summaries[items[i].ImdbID]; ok {
+			items[i].Movie = &summary
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// recoveryCodeCount is the number of recovery codes handed out at enrollment.
+const recoveryCodeCount = 10
+
+// LoginMFA is the second step of a login with two-factor authentication.
+// It exchanges the challenge token returned by LoginUser and a TOTP (or recovery) code for a session.
+// Wrong codes count as failed logins, so the code cannot be brute-forced either.
+func LoginMFA(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.MFALoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		userID, err := utils.ValidateMFAChallengeToken(req.MFAToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Invalid or expired MFA challenge, please log in again"})
+			return
+		}
+
+		user, err := findUserByID(userID, client, c)
+		if err != nil || !user.TOTPEnabled || user.Disabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Invalid or expired MFA challenge, please log in again"})
+			return
+		}
+
+		accountKey, ipKey := utils.LoginAttemptKeys(user.Email, c)
+		wait, err := utils.GetLoginLockout(accountKey, ipKey, client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check login attempts"})
+			return
+		}
+		if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"Error": "Too many failed login attempts, please try again later"})
+			return
+		}
+
+		ok, err := verifySecondFactor(user, req.Code, req.RecoveryCode, client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check the code"})
+			return
+		}
+		if !ok {
+			if err := utils.RecordLoginFailure(accountKey, ipKey, client, c); err != nil {
+				log.Println("Failed to record login failure:", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Invalid code"})
+			return
+		}
+
+		startSession(c, client, *user, true)
+	}
+}
+
+// EnrollTOTP starts two-factor enrollment. It returns a new secret and the otpauth:// URI
+// to show as a QR code. The secret only becomes active once ConfirmTOTP receives a valid code.
+func EnrollTOTP(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"Error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate secret"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{"totp_pending_secret": secret, "updated_at": time.Now()}}
+		if _, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to store secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPURI(secret, user.Email),
+		})
+	}
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their app produces
+// valid codes. It returns the recovery codes (only this once) and upgrades the current
+// session to a two-factor session.
+func ConfirmTOTP(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "A code from the authenticator app is required"})
+			return
+		}
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"Error": "Two-factor authentication is already enabled"})
+			return
+		}
+		if user.TOTPPendingSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Start the enrollment first"})
+			return
+		}
+
+		step, valid := utils.ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid code"})
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate recovery codes"})
+			return
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"totp_enabled":   true,
+				"totp_secret":    user.TOTPPendingSecret,
+				"totp_last_step": step,
+				"recovery_codes": hashes,
+				"updated_at":     time.Now(),
+			},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		}
+		if _, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to enable two-factor authentication"})
+			return
+		}
+
+		// The user just proved possession of the second factor
+		if err := openSession(c, client, *user, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe, they are only shown once",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// DisableTOTP turns two-factor authentication off. A current code or a recovery code is required.
+func DisableTOTP(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"Error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		valid, err := verifySecondFactor(user, req.Code, req.RecoveryCode, client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check the code"})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid code"})
+			return
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"totp_enabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{"totp_secret": "", "totp_pending_secret": "", "totp_last_step": "", "recovery_codes": ""},
+		}
+		if _, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to disable two-factor authentication"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes. A current TOTP code is required.
+func RegenerateRecoveryCodes(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.TOTPCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "A code from the authenticator app is required"})
+			return
+		}
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"Error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		valid, err := verifySecondFactor(user, req.Code, "", client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check the code"})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid code"})
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to generate recovery codes"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{"recovery_codes": hashes, "updated_at": time.Now()}}
+		if _, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to store recovery codes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code.
+//
+// Both checks are made atomic in MongoDB: a TOTP code is only accepted if its time
+// step is newer than the last accepted one, and a recovery code is removed as it is used.
+// This way a code cannot be used twice, even by concurrent requests.
+func verifySecondFactor(user *models.User, code, recoveryCode string, client *mongo.Client, c *gin.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	users := database.OpenCollection("users", client)
+
+	if code != "" {
+		step, valid := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		filter := bson.M{
+			"user_id": user.UserID,
+			"$or": bson.A{
+				bson.M{"totp_last_step": bson.M{"$lt": step}},
+				bson.M{"totp_last_step": bson.M{"$exists": false}},
+			},
+		}
+		result, err := users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashRecoveryCode(recoveryCode)
+		result, err := users.UpdateOne(ctx,
+			bson.M{"user_id": user.UserID, "recovery_codes": hash},
+			bson.M{"$pull": bson.M{"recovery_codes": hash}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+
+	return false, nil
+}
+
+// findUserByID loads a full user document.
+func findUserByID(userID string, client *mongo.Client, c *gin.Context) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := database.OpenCollection("users", client).FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// currentUser loads the authenticated user. On failure it writes the error response and returns false.
+func currentUser(client *mongo.Client, c *gin.Context) (*models.User, bool) {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return nil, false
+	}
+
+	user, err := findUserByID(userID, client, c)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+		return nil, false
+	}
+	return user, true
+}
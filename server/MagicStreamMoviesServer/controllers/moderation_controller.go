@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/moderation"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ListModerationItems returns the moderation queue, oldest first so that nothing waits forever.
+// ?status= filters on pending (default), approved, rejected or superseded, and
+// ?content_type= on the kind of content.
+func ListModerationItems(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		status := c.DefaultQuery("status", models.ModerationPending)
+		switch status {
+		case models.ModerationPending, models.ModerationApproved, models.ModerationRejected, models.ModerationSuperseded:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "status must be one of pending, approved, rejected, superseded"})
+			return
+		}
+
+		filter := bson.M{"status": status}
+		if contentType := c.Query("content_type"); contentType != "" {
+			filter["content_type"] = contentType
+		}
+
+		queue := database.OpenCollection("moderation_queue", client)
+		total, err := queue.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count moderation items"})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetSkip((page - 1) * pageSize).
+			SetLimit(pageSize)
+		cursor, err := queue.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch moderation items"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		items := []models.ModerationItem{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode moderation items"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ModerationPage{Items: items, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// ApproveModerationItem publishes held text. A reason is optional.
+func ApproveModerationItem(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decideModerationItem(c, true, client)
+	}
+}
+
+// RejectModerationItem keeps held text hidden. The reason is required and shown to the author.
+func RejectModerationItem(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decideModerationItem(c, false, client)
+	}
+}
+
+func decideModerationItem(c *gin.Context, approve bool, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	adminID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+
+	var req models.ModerationDecisionRequest
+	// The body is optional when approving
+	if c.Request.ContentLength != 0 || !approve {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+	}
+	if err := validate.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if !approve && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "A reason is required to reject"})
+		return
+	}
+
+	item, err := moderation.Decide(ctx, c.Param("item_id"), approve, req.Reason, adminID, client)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Moderation item not found"})
+		case errors.Is(err, moderation.ErrNotPending):
+			c.JSON(http.StatusConflict, gin.H{"Error": "Moderation item is no longer pending"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to record decision"})
+		}
+		return
+	}
+
+	action := models.AuditActionModerationReject
+	if approve {
+		action = models.AuditActionModerationApprove
+	}
+	details := bson.M{"item_id": item.ItemID, "content_type": item.ContentType, "content_id": item.ContentID, "reason": req.Reason}
+	if err := utils.RecordAudit(adminID, action, item.UserID, details, client, ctx); err != nil {
+		log.Println("Failed to write audit log:", err)
+	}
+
+	c.JSON(http.StatusOK, item)
+}
@@ -7,12 +7,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/experiments"
+	"github.com/eichiarakaki/magic-stream/llm"
 	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/recommender"
 	"github.com/eichiarakaki/magic-stream/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -20,22 +24,36 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
-	"google.golang.org/genai"
 )
 
 var validate = validator.New()
 
+const (
+	defaultRecommendedMovieLimit = 5
+	maxRecommendedMovieLimit     = 50
+)
+
+// GetMovies lists the movies, optionally filtered by the query parameters of
+// utils.MovieFilter (genre, release year, runtime, age rating, language, cast,
+// director and title).
 func GetMovies(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
 		defer cancel()
 
-		var movies []models.Movie
+		filter, err := utils.MovieFilter(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		movies := []models.Movie{}
 
-		// Doing a request to the MongoDB with NO filters.
-		cursor, err := database.OpenCollection("movies", client).Find(ctx, bson.M{})
+		// Doing a request to the MongoDB with the filters, if any.
+		cursor, err := database.OpenCollection("movies", client).Find(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch movies"})
+			return
 		}
 		// Closing the final cursor to prevent memory leaks.
 		defer func(cursor *mongo.Cursor, ctx context.Context) {
@@ -48,6 +66,7 @@ func GetMovies(client *mongo.Client) gin.HandlerFunc {
 		// Converting the cursor to the movies slice
 		if err = cursor.All(ctx, &movies); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode movies"})
+			return
 		}
 
 		c.JSON(http.StatusOK, movies)
@@ -88,13 +107,20 @@ func AddMovie(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
+		utils.NormalizeMovie(&movie)
 		if err := validate.Struct(&movie); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
 			return
 		}
+		movie.UserRating = nil // Only maintained from reviews
+		movie.Enrichment = nil // Only through the enrichment endpoints
 
 		// Inserting a new movie to the MongoDB
 		result, err := database.OpenCollection("movies", client).InsertOne(ctx, movie)
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"Error": "A movie with this imdb_id already exists"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to add movie"})
 			return
@@ -205,31 +231,25 @@ func GetReviewRanking(admin_review string, client *mongo.Client, c *gin.Context)
 
 	// Connecting to Gemini
 	ctx := context.Background()
-	// The client gets the API key from the environment variable `GEMINI_API_KEY`.
-	genai_client, err := genai.NewClient(ctx, nil)
+	llmClient, err := llm.Default(ctx)
 	if err != nil {
 		log.Println("Warning: genai client failed", err)
 		return "", 0, err
 	}
-	response, err := genai_client.Models.GenerateContent(
-		ctx,
-		"gemini-2.5-flash",
-		genai.Text(base_prompt+admin_review),
-		nil,
-	)
+	sentiment, err := llmClient.Generate(ctx, base_prompt+admin_review)
 	if err != nil {
 		return "", 0, err
 	}
 
 	rankVal := 0
 	for _, ranking := range rankings {
-		if ranking.RankingName == response.Text() {
+		if ranking.RankingName == sentiment {
 			rankVal = ranking.RankingValue
 			break
 		}
 	}
 
-	return response.Text(), rankVal, nil
+	return sentiment, rankVal, nil
 }
 
 // GetRankings request the existing rankings data from the MongoDB
@@ -257,38 +277,32 @@ func GetRankings(client *mongo.Client, c *gin.Context) ([]models.Ranking, error)
 	return rankings, nil
 }
 
-// GetRecommendedMovies returns a handler that recommends movies
-// based on a user's favorite genres.
+// GetRecommendedMovies returns a handler that recommends movies the user
+// has not watched yet, each with the reason it was picked.
 //
 // HOW THIS ENDPOINT WORKS
 // -------------------------------------------------------------
 // 1. Extract the user ID from the request context (Auth middleware).
-// 2. Get a list of the user’s favorite genres from MongoDB.
-// 3. Load environment variable RECOMMENDED_MOVIE_LIMIT (default = 5).
-// 4. Query the movies collection:
-//   - Filter: any movie whose genre matches user's favorites
-//   - Sort: by ranking.ranking_value (ascending → better ranking first)
-//   - Limit: maximum number of movies to return
-//
-// 5. Decode results into []models.Movie
-// 6. Return JSON with recommended movies.
+// 2. Read the query parameters:
+//   - limit: how many movies to return (default = 5, max = 50)
+//   - genres: comma separated genre names that replace the user's
+//     favorite genres, checked against the genres collection
 //
-// MONGO FILTER EXPLAINED
-// -------------------------------------------------------------
-//
-//	filter := bson.M{
-//	    "genre.genre_name": bson.M{"$in": favorite_genres}
-//	}
+// 3. Get a list of the user’s favorite genres from MongoDB.
+// 4. If a recommendation experiment runs, put the user in one of its
+// variants: the variant decides which recommendation strategy is used.
+// 5. Let the recommender package pick the movies:
+//   - Movies liked by the users who liked the same movies as this user,
+//     recomputed by a background job every RECOMMENDATION_JOB_INTERVAL
+//   - If there are not enough (new users, cold start), the best ranked
+//     movies of the requested or favorite genres
+//   - Movies the user already finished are left out
+//   - The candidates are re-ranked so that one genre can't dominate
 //
-// "$in" means: select all movies where genre.genre_name appears
-// in the user's favorite genres list.
+// During an experiment, the movies are logged as impressions of the variant.
+// 6. Return JSON with recommended movies and their reasons.
 //
-// MONGO FIND OPTIONS
-// -------------------------------------------------------------
-// SetSort → order results by a specific field
-// SetLimit → maximum number of documents to return
-//
-// EXPECTED MOVIE DOCUMENT STRUCTURE
+// EXPECTED RESPONSE ITEM
 // -------------------------------------------------------------
 //
 //	{
@@ -299,7 +313,8 @@ func GetRankings(client *mongo.Client, c *gin.Context) ([]models.Ranking, error)
 //	  ],
 //	  "ranking": {
 //	      "ranking_value": 120
-//	  }
+//	  },
+//	  "reason": "Because you like Sci-Fi"
 //	}
 func GetRecommendedMovies(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -311,68 +326,114 @@ func GetRecommendedMovies(client *mongo.Client) gin.HandlerFunc {
 			return // ← IMPORTANT! Stop execution
 		}
 
-		// 2. Fetch user's favorite genres from DB
-		favorite_genres, err := GetUsersFavoriteGenres(userID, client, c)
+		// 2. Query parameters
+		limit := defaultRecommendedMovieLimit
+		if raw := c.Query("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxRecommendedMovieLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": fmt.Sprintf("limit must be between 1 and %d", maxRecommendedMovieLimit)})
+				return
+			}
+		}
+
+		// Create context with timeout
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var genres []string
+		if raw := c.Query("genres"); raw != "" {
+			genres, err = resolveGenreNames(strings.Split(raw, ","), client, ctx)
+			if errors.Is(err, errUnknownGenre) {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check genres"})
+				return
+			}
+		}
+
+		// 3. Favorite genres, used when no genres were requested
+		favoriteGenres, err := GetUsersFavoriteGenres(userID, client, c)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
 			return
 		}
 
-		// 3. Load .env (not required in production, but fine for local dev)
-		err = godotenv.Load(".env")
+		// 4. Strategy of the user's variant if an experiment runs, default otherwise
+		strategy := recommender.StrategyDiversified
+		experiment, err := experiments.Running(ctx, client)
 		if err != nil {
-			log.Println("Warning: .env file not found")
+			log.Println("Failed to look up the running experiment:", err)
 		}
-
-		// Default recommended limit = 5
-		var recommendedMovieLimitVal int64 = 5
-
-		// If the env var exists, convert it to integer
-		recommendedMovieLimitStr := os.Getenv("RECOMMENDED_MOVIE_LIMIT")
-		if recommendedMovieLimitStr != "" {
-			recommendedMovieLimitVal, _ = strconv.ParseInt(recommendedMovieLimitStr, 10, 64)
+		var variant models.ExperimentVariant
+		if experiment != nil {
+			variant = experiments.Assign(experiment, userID)
+			strategy = variant.Strategy
 		}
 
-		// 4. Mongo query options: sort + limit
-		findOptions := options.Find()
-		findOptions.SetSort(bson.D{{Key: "ranking.ranking_value", Value: 1}}) // ascending
-		findOptions.SetLimit(recommendedMovieLimitVal)
+		// 5. Collaborative filtering, genre top-up and diversification
+		recommendedMovies, err := recommender.Recommend(ctx, recommender.Request{
+			UserID:         userID,
+			Limit:          limit,
+			Strategy:       strategy,
+			Genres:         genres,
+			FavoriteGenres: favoriteGenres,
+		}, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Error fetching recommended movies"})
+			return
+		}
 
-		// 5. Filter: match movies whose genre_name is in the user’s favorites
-		filter := bson.M{
-			"genre.genre_name": bson.M{
-				"$in": favorite_genres,
-			},
+		if experiment != nil {
+			if err := experiments.LogImpressions(ctx, experiment, variant.Name, userID, recommendedMovies, client); err != nil {
+				log.Println("Failed to log recommendation impressions:", err)
+			}
 		}
 
-		// 6. Create context with timeout
-		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
-		defer cancel()
+		// 6. Return movie list as JSON
+		c.JSON(http.StatusOK, recommendedMovies)
+	}
+}
 
-		// 7. Perform the query
-		cursor, err := database.OpenCollection("movies", client).Find(ctx, filter, findOptions)
+// resolveGenreNames checks the genre names against the genres collection, ignoring case,
+// and returns them with their canonical names, without duplicates.
+func resolveGenreNames(requested []string, client *mongo.Client, ctx context.Context) ([]string, error) {
+	cursor, err := database.OpenCollection("genres", client).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
-			return
+			log.Println(err)
 		}
+	}(cursor, ctx)
 
-		// Ensure the cursor is closed after usage
-		defer func(cursor *mongo.Cursor, ctx context.Context) {
-			if err := cursor.Close(ctx); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
-			}
-		}(cursor, ctx)
+	var known []models.Genre
+	if err := cursor.All(ctx, &known); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]string, len(known))
+	for _, genre := range known {
+		byName[strings.ToLower(genre.GenreName)] = genre.GenreName
+	}
 
-		// 8. Decode results into Go struct
-		var recommendedMovies []models.Movie
-		if err = cursor.All(ctx, &recommendedMovies); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Error fetching recommended movies"})
-			return
+	var genres []string
+	for _, name := range requested {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		canonical, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errUnknownGenre, name)
+		}
+		if !slices.Contains(genres, canonical) {
+			genres = append(genres, canonical)
 		}
-
-		// 9. Return movie list as JSON
-		c.JSON(http.StatusOK, recommendedMovies)
 	}
+	return genres, nil
 }
 
 // GetUsersFavoriteGenres retrieves a list of genre names from the user's
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/oidc"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// errOIDCAccountConflict is returned when the email of the identity belongs to an account
+// that cannot be linked to it (already linked elsewhere, or the email is not verified by
+// the provider or on the account).
+var errOIDCAccountConflict = errors.New("account conflict")
+
+// OIDCLogin starts a login at the OpenID Connect provider (authorization code flow with PKCE).
+// The state, nonce and code verifier are kept in a short-lived signed cookie for OIDCCallback.
+func OIDCLogin(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		provider, err := oidc.Default(ctx)
+		if err != nil {
+			log.Println("OIDC:", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"Error": "Single sign-on is not available"})
+			return
+		}
+
+		state, err1 := oidc.RandomString(32)
+		nonce, err2 := oidc.RandomString(32)
+		codeVerifier, err3 := oidc.RandomString(32)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start the login"})
+			return
+		}
+
+		stateToken, err := utils.GenerateOIDCStateToken(state, nonce, codeVerifier)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start the login"})
+			return
+		}
+		utils.GetCookiePolicy().SetOIDCStateCookie(c, stateToken)
+
+		c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, codeVerifier))
+	}
+}
+
+// OIDCCallback finishes a login at the OpenID Connect provider. It validates the state,
+// exchanges the code, verifies the ID token, links or provisions the user and opens a
+// normal MagicStream session. The browser is then sent back to the frontend
+// (OIDC_POST_LOGIN_REDIRECT); errors and MFA challenges are passed in the URL fragment.
+func OIDCCallback(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		policy := utils.GetCookiePolicy()
+		stateCookie, _ := policy.Cookie(c, utils.OIDCStateCookie)
+		policy.ClearOIDCStateCookie(c) // A state is only ever good for one callback
+
+		if idpError := c.Query("error"); idpError != "" {
+			log.Println("OIDC: provider returned", idpError, c.Query("error_description"))
+			oidcRedirect(c, url.Values{"error": {"access_denied"}})
+			return
+		}
+
+		flow, err := utils.ValidateOIDCStateToken(stateCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(c.Query("state"))) != 1 {
+			oidcRedirect(c, url.Values{"error": {"invalid_state"}})
+			return
+		}
+
+		provider, err := oidc.Default(ctx)
+		if err != nil {
+			log.Println("OIDC:", err)
+			oidcRedirect(c, url.Values{"error": {"unavailable"}})
+			return
+		}
+
+		rawIDToken, err := provider.Exchange(ctx, c.Query("code"), flow.CodeVerifier)
+		if err != nil {
+			log.Println("OIDC: code exchange failed:", err)
+			oidcRedirect(c, url.Values{"error": {"login_failed"}})
+			return
+		}
+		claims, err := provider.VerifyIDToken(ctx, rawIDToken, flow.Nonce)
+		if err != nil {
+			log.Println("OIDC:", err)
+			oidcRedirect(c, url.Values{"error": {"login_failed"}})
+			return
+		}
+
+		user, err := linkOIDCUser(ctx, provider.Config(), claims, client)
+		if err != nil {
+			if errors.Is(err, errOIDCAccountConflict) {
+				oidcRedirect(c, url.Values{"error": {"account_conflict"}})
+				return
+			}
+			log.Println("OIDC: failed to link user:", err)
+			oidcRedirect(c, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		if user.Disabled {
+			oidcRedirect(c, url.Values{"error": {"account_disabled"}})
+			return
+		}
+		if !user.EmailVerified && utils.GetUnverifiedAccountPolicy() == utils.UnverifiedBlock {
+			oidcRedirect(c, url.Values{"error": {"email_unverified"}})
+			return
+		}
+
+		// A second factor done at the provider counts as ours. Otherwise users who enabled
+		// TOTP here still have to enter a code, exactly as after a password login.
+		mfa := claims.MultiFactor()
+		if user.TOTPEnabled && !mfa {
+			mfaToken, err := utils.GenerateMFAChallengeToken(user.UserID)
+			if err != nil {
+				oidcRedirect(c, url.Values{"error": {"server_error"}})
+				return
+			}
+			oidcRedirect(c, url.Values{"mfa_token": {mfaToken}})
+			return
+		}
+
+		if err := openSession(c, client, *user, mfa); err != nil {
+			log.Println("OIDC:", err)
+			oidcRedirect(c, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		oidcRedirect(c, nil)
+	}
+}
+
+// linkOIDCUser finds the user for a verified identity, in this order:
+//  1. the account already linked to the issuer and subject;
+//  2. an unlinked account with the same email, if both the provider and the account
+//     verified that email;
+//  3. a new account, provisioned from the claims.
+//
+// When the provider manages roles (OIDC_ADMIN_GROUPS), the role follows the groups on every login.
+func linkOIDCUser(ctx context.Context, config oidc.Config, claims *oidc.IDTokenClaims, client *mongo.Client) (*models.User, error) {
+	users := database.OpenCollection("users", client)
+	email := utils.NormalizeEmail(claims.Email)
+
+	var user models.User
+	err := users.FindOne(ctx, bson.M{"oidc_issuer": config.IssuerURL, "oidc_subject": claims.Subject}).Decode(&user)
+	switch {
+	case err == nil:
+
+	case errors.Is(err, mongo.ErrNoDocuments):
+		if email == "" {
+			return nil, errOIDCAccountConflict
+		}
+
+		err = users.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+		switch {
+		case err == nil:
+			if !claims.CanLinkAccount(user.EmailVerified, user.OIDCSubject != "") {
+				return nil, errOIDCAccountConflict
+			}
+			if err := linkExistingOIDCUser(ctx, &user, config, claims, client); err != nil {
+				return nil, err
+			}
+
+		case errors.Is(err, mongo.ErrNoDocuments):
+			if err := provisionOIDCUser(ctx, &user, config, claims, client); err != nil {
+				return nil, err
+			}
+			return &user, nil
+
+		default:
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	if config.MapsRoles() {
+		if err := syncOIDCRole(ctx, &user, config.IsAdmin(claims.Groups), client); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func linkExistingOIDCUser(ctx context.Context, user *models.User, config oidc.Config, claims *oidc.IDTokenClaims, client *mongo.Client) error {
+	set := bson.M{
+		"oidc_issuer":  config.IssuerURL,
+		"oidc_subject": claims.Subject,
+		"updated_at":   time.Now(),
+	}
+
+	// Only link if nobody linked the account in the meantime
+	filter := bson.M{"user_id": user.UserID, "email_verified": true, "oidc_subject": bson.M{"$exists": false}}
+	result, err := database.OpenCollection("users", client).UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errOIDCAccountConflict
+	}
+
+	user.OIDCIssuer = config.IssuerURL
+	user.OIDCSubject = claims.Subject
+
+	details := bson.M{"issuer": config.IssuerURL, "subject": claims.Subject}
+	if err := utils.RecordAudit(user.UserID, models.AuditActionOIDCLink, user.UserID, details, client, ctx); err != nil {
+		log.Println("Failed to write audit log:", err)
+	}
+	return nil
+}
+
+func provisionOIDCUser(ctx context.Context, user *models.User, config oidc.Config, claims *oidc.IDTokenClaims, client *mongo.Client) error {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	role := models.RoleUser
+	if config.IsAdmin(claims.Groups) {
+		role = models.RoleAdmin
+	}
+
+	now := time.Now()
+	*user = models.User{
+		UserID:         bson.NewObjectID().Hex(),
+		FirstName:      firstName,
+		LastName:       lastName,
+		Email:          utils.NormalizeEmail(claims.Email),
+		Password:       "", // No password: this account can only log in through the provider (or after a password reset)
+		EmailVerified:  bool(claims.EmailVerified),
+		Role:           role,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		FavoriteGenres: []models.Genre{},
+		OIDCIssuer:     config.IssuerURL,
+		OIDCSubject:    claims.Subject,
+		SchemaVersion:  models.UserSchemaVersion,
+	}
+	if user.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	if _, err := database.OpenCollection("users", client).InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errOIDCAccountConflict
+		}
+		return err
+	}
+
+	if role == models.RoleAdmin {
+		details := bson.M{"from": "", "to": role, "reason": "oidc_groups"}
+		if err := utils.RecordAudit("oidc", models.AuditActionRoleChange, user.UserID, details, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+	}
+	return nil
+}
+
+// syncOIDCRole applies the role given by the provider's groups. Like UpdateUserRole,
+// it never demotes the last enabled admin.
+func syncOIDCRole(ctx context.Context, user *models.User, isAdmin bool, client *mongo.Client) error {
+	role := models.RoleUser
+	if isAdmin {
+		role = models.RoleAdmin
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	users := database.OpenCollection("users", client)
+	if user.Role == models.RoleAdmin {
+		admins, err := users.CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			log.Println("OIDC: not demoting", user.Email, "because they are the last admin")
+			return nil
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}}
+	if _, err := users.UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+		return err
+	}
+
+	details := bson.M{"from": user.Role, "to": role, "reason": "oidc_groups"}
+	if err := utils.RecordAudit("oidc", models.AuditActionRoleChange, user.UserID, details, client, ctx); err != nil {
+		log.Println("Failed to write audit log:", err)
+	}
+	user.Role = role
+	return nil
+}
+
+// oidcRedirect sends the browser back to the frontend. Values go in the fragment,
+// so they are never sent to a server or logged in access logs.
+func oidcRedirect(c *gin.Context, fragment url.Values) {
+	target := os.Getenv("OIDC_POST_LOGIN_REDIRECT")
+	if target == "" {
+		target = "https://localhost:5173/"
+	}
+	if len(fragment) > 0 {
+		target += "#" + fragment.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
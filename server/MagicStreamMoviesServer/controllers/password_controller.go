@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/mailer"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// passwordResetTTL is how long a password reset link stays valid.
+const passwordResetTTL = 30 * time.Minute
+
+// ForgotPassword starts the password reset flow.
+//
+// The response is the same whether or not the email belongs to an account, and the
+// lookup, token creation and email all happen in the background, so neither the
+// body nor the response time reveal which emails are registered.
+func ForgotPassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		req.Email = utils.NormalizeEmail(req.Email)
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		go sendPasswordResetEmail(req.Email, client)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "If an account exists for this email, a password reset link has been sent",
+		})
+	}
+}
+
+func sendPasswordResetEmail(email string, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := database.OpenCollection("users", client).FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println("Password reset: failed to look up user:", err)
+		}
+		return
+	}
+
+	rawToken, err := utils.IssueOneTimeToken(user.UserID, models.TokenPurposePasswordReset, passwordResetTTL, client, ctx)
+	if err != nil {
+		log.Println("Password reset: failed to issue token:", err)
+		return
+	}
+
+	resetURL := os.Getenv("PASSWORD_RESET_URL")
+	if resetURL == "" {
+		resetURL = "https://localhost:5173/reset-password"
+	}
+	link := resetURL + "?token=" + url.QueryEscape(rawToken)
+
+	err = mailer.Default().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your MagicStream password",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Someone asked to reset the password of your MagicStream account.\n" +
+			"Use the link below within 30 minutes to choose a new password:\n\n" +
+			link + "\n\n" +
+			"If this was not you, you can ignore this email.\n",
+	})
+	if err != nil {
+		log.Println("Password reset: failed to send email:", err)
+	}
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword.
+// The token can only be used once, and every existing session of the user is ended.
+func ResetPassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		token, err := utils.ConsumeOneTimeToken(req.Token, models.TokenPurposePasswordReset, client, c)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidOneTimeToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check reset token"})
+			return
+		}
+
+		hashedPassword, err := HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to hash password"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{
+			"password":   hashedPassword,
+			"updated_at": time.Now(),
+		}}
+		result, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": token.UserID}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update password"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": utils.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		if err := utils.RevokeUserSessions(token.UserID, client, c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to end existing sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+	}
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/privacy"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ExportMyData returns a ZIP archive of everything stored about the current user.
+func ExportMyData(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+
+		sendExport(c, user, user.UserID, client)
+	}
+}
+
+// ExportUserData lets an admin export a user's data, e.g. to answer a request received by email.
+func ExportUserData(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		user, err := findUserByID(c.Param("user_id"), client, c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+
+		sendExport(c, user, adminID, client)
+	}
+}
+
+// sendExport builds the archive in memory first, so that a failure half way
+// returns an error instead of a truncated file. Every export is audited.
+func sendExport(c *gin.Context, user *models.User, actorID string, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	var archive bytes.Buffer
+	if err := privacy.WriteExport(ctx, &archive, user, client); err != nil {
+		log.Println("Data export failed for", user.UserID, ":", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to export data"})
+		return
+	}
+
+	if err := utils.RecordAudit(actorID, models.AuditActionExport, user.UserID, nil, client, ctx); err != nil {
+		log.Println("Failed to write audit log:", err)
+	}
+
+	filename := "magicstream-export-" + user.UserID + "-" + time.Now().UTC().Format("20060102") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// EraseUser starts the erasure of a user's account and personal data on behalf of an
+// admin, and returns the job; its result points to the erasure report. A failed erasure
+// stops before the user document is deleted, so it can be started again. Admins cannot
+// erase themselves here (DELETE /me) nor the last admin.
+func EraseUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		adminID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.UserEraseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		targetID := c.Param("user_id")
+		if targetID == adminID {
+			c.JSON(http.StatusConflict, gin.H{"Error": "Use DELETE /me to delete your own account"})
+			return
+		}
+
+		user, err := findUserByID(targetID, client, c)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch user"})
+			return
+		}
+
+		if user.Role == models.RoleAdmin {
+			admins, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count admins"})
+				return
+			}
+			if admins <= 1 && !user.Disabled {
+				c.JSON(http.StatusConflict, gin.H{"Error": "Cannot erase the last admin"})
+				return
+			}
+		}
+
+		job, err := privacy.StartErasure(user, adminID, req.Reason, models.AuditActionErase, client)
+		if errors.Is(err, jobs.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"Error": "This user is already being erased"})
+			return
+		}
+		if err != nil {
+			log.Println("Failed to start erasure for", targetID, ":", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to start the erasure"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetErasureReport returns an erasure report, as proof that the erasure was done.
+func GetErasureReport(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		report, err := privacy.FindErasureReport(ctx, c.Param("report_id"), client)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "Erasure report not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch erasure report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
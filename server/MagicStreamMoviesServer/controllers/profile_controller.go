@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/privacy"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errUnknownGenre is returned by resolveGenres for genres that are not in the genres collection.
+var errUnknownGenre = errors.New("unknown genre")
+
+// GetProfile returns the current user's own account.
+func GetProfile(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, toProfileResponse(user))
+	}
+}
+
+// UpdateProfile changes the current user's name and favourite genres.
+// Genres must exist in the genres collection; their names are taken from there.
+func UpdateProfile(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.ProfileUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if req.FirstName != nil {
+			set["first_name"] = *req.FirstName
+		}
+		if req.LastName != nil {
+			set["last_name"] = *req.LastName
+		}
+		if req.FavoriteGenres != nil {
+			genres, err := resolveGenres(*req.FavoriteGenres, client, ctx)
+			if err != nil {
+				if errors.Is(err, errUnknownGenre) {
+					c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check genres"})
+				return
+			}
+			set["favourite_genres"] = genres
+		}
+
+		var updated models.User
+		err := database.OpenCollection("users", client).FindOneAndUpdate(ctx,
+			bson.M{"user_id": user.UserID},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update profile"})
+			return
+		}
+
+		c.JSON(http.StatusOK, toProfileResponse(&updated))
+	}
+}
+
+// ChangePassword sets a new password after checking the current one. Wrong current
+// passwords count as failed logins. Every other session of the user is ended;
+// the session making the request gets new tokens.
+func ChangePassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.PasswordChangeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+
+		if !checkCurrentPassword(user, req.CurrentPassword, client, c) {
+			return
+		}
+
+		hashedPassword, err := HashPassword(req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to hash password"})
+			return
+		}
+
+		// Ending every session signs the user out on all devices
+		update := bson.M{"$set": bson.M{"password": hashedPassword, "sessions": bson.A{}, "updated_at": time.Now()}}
+		if _, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update password"})
+			return
+		}
+
+		// A new session keeps this device signed in
+		if err := openSession(c, client, *user, utils.GetMFAFromContext(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Password changed, please log in again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+	}
+}
+
+// DeleteAccount signs the current user out everywhere and starts the erasure of their
+// account and personal data, returning the job ID. Accounts with a password must confirm
+// with it, and the last enabled admin cannot delete their account.
+func DeleteAccount(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		user, ok := currentUser(client, c)
+		if !ok {
+			return
+		}
+
+		// Accounts without a password (OIDC) may send no body at all
+		if user.Password != "" {
+			var req models.AccountDeleteRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+				return
+			}
+			if !checkCurrentPassword(user, req.Password, client, c) {
+				return
+			}
+		}
+
+		// Never leave the platform without an admin (disabled admins do not count)
+		if user.Role == models.RoleAdmin {
+			admins, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"role": models.RoleAdmin, "disabled": bson.M{"$ne": true}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count admins"})
+				return
+			}
+			if admins <= 1 {
+				c.JSON(http.StatusConflict, gin.H{"Error": "Cannot delete the last admin account"})
+				return
+			}
+		}
+
+		// The account stops being usable right away, even if the erasure takes a while
+		if err := utils.RevokeUserSessions(user.UserID, client, c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete account"})
+			return
+		}
+
+		job, err := privacy.StartErasure(user, user.UserID, "self-service deletion", models.AuditActionDelete, client)
+		if err != nil && !errors.Is(err, jobs.ErrRunning) {
+			log.Println("Failed to start account deletion for", user.UserID, ":", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete account"})
+			return
+		}
+
+		utils.GetCookiePolicy().ClearAuthCookies(c)
+		response := gin.H{"message": "Account deletion started"}
+		if job != nil {
+			response["job_id"] = job.JobID
+		}
+		c.JSON(http.StatusAccepted, response)
+	}
+}
+
+// checkCurrentPassword re-authenticates the user with their password, with the same
+// lockout as LoginUser. On failure it writes the error response and returns false.
+func checkCurrentPassword(user *models.User, password string, client *mongo.Client, c *gin.Context) bool {
+	accountKey, ipKey := utils.LoginAttemptKeys(user.Email, c)
+	wait, err := utils.GetLoginLockout(accountKey, ipKey, client, c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check login attempts"})
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"Error": "Too many failed attempts, please try again later"})
+		return false
+	}
+
+	if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		if err := utils.RecordLoginFailure(accountKey, ipKey, client, c); err != nil {
+			log.Println("Failed to record login failure:", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// resolveGenres checks the genres against the genres collection and returns them with
+// their canonical names, without duplicates.
+func resolveGenres(requested []models.Genre, client *mongo.Client, ctx context.Context) ([]models.Genre, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, genre := range requested {
+		if !seen[genre.GenreID] {
+			seen[genre.GenreID] = true
+			ids = append(ids, genre.GenreID)
+		}
+	}
+
+	cursor, err := database.OpenCollection("genres", client).Find(ctx, bson.M{"genre_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	var known []models.Genre
+	if err := cursor.All(ctx, &known); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Genre, len(known))
+	for _, genre := range known {
+		byID[genre.GenreID] = genre
+	}
+
+	genres := make([]models.Genre, 0, len(ids))
+	for _, id := range ids {
+		genre, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: genre_id %d", errUnknownGenre, id)
+		}
+		genres = append(genres, genre)
+	}
+	return genres, nil
+}
+
+func toProfileResponse(user *models.User) models.ProfileResponse {
+	return models.ProfileResponse{
+		UserID:          user.UserID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		EmailVerified:   user.EmailVerified,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Role:            user.Role,
+		FavoriteGenres:  user.FavoriteGenres,
+		TOTPEnabled:     user.TOTPEnabled,
+		SingleSignOn:    user.OIDCSubject != "",
+		HasPassword:     user.Password != "",
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
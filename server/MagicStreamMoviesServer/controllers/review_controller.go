@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/moderation"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// reviewSorts maps the sort query parameter of GetMovieReviews to a sort order.
+var reviewSorts = map[string]bson.D{
+	models.ReviewSortNewest:  {{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	models.ReviewSortOldest:  {{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+	models.ReviewSortHighest: {{Key: "rating", Value: -1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	models.ReviewSortLowest:  {{Key: "rating", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+}
+
+// GetMovieReviews returns the reviews of a movie, paginated. ?sort= is one of
+// newest (default), oldest, highest or lowest.
+func GetMovieReviews(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		sort, ok := reviewSorts[c.DefaultQuery("sort", models.ReviewSortNewest)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "sort must be one of newest, oldest, highest, lowest"})
+			return
+		}
+
+		imdbID := c.Param("imdb_id")
+		exists, err := movieExists(imdbID, client, ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+			return
+		}
+
+		reviews := database.OpenCollection("reviews", client)
+		filter := bson.M{"imdb_id": imdbID}
+		total, err := reviews.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count reviews"})
+			return
+		}
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$sort", Value: sort}},
+			{{Key: "$skip", Value: (page - 1) * pageSize}},
+			{{Key: "$limit", Value: pageSize}},
+			{{Key: "$lookup", Value: bson.M{
+				"from":         "users",
+				"localField":   "user_id",
+				"foreignField": "user_id",
+				"as":           "author",
+				"pipeline":     bson.A{bson.M{"$project": bson.M{"_id": 0, "first_name": 1}}},
+			}}},
+			// Reviews of erased accounts are anonymous and have no author
+			{{Key: "$set", Value: bson.M{
+				"author": bson.M{"$arrayElemAt": bson.A{"$author.first_name", 0}},
+				// Text held or rejected by moderation is not shown; the rating still is
+				"text": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$moderation_status", models.ModerationApproved}}, models.ModerationApproved}},
+					"$text",
+					"$$REMOVE",
+				}},
+			}}},
+			{{Key: "$unset", Value: "moderation_reason"}},
+		}
+
+		cursor, err := reviews.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch reviews"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		items := []models.Review{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode reviews"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ReviewPage{Items: items, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// GetMyReviews returns the reviews written by the current user, most recently changed first.
+func GetMyReviews(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		reviews := database.OpenCollection("reviews", client)
+		filter := bson.M{"user_id": userID}
+		total, err := reviews.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count reviews"})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip((page - 1) * pageSize).
+			SetLimit(pageSize)
+		cursor, err := reviews.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch reviews"})
+			return
+		}
+		defer func(cursor *mongo.Cursor, ctx context.Context) {
+			err := cursor.Close(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+		}(cursor, ctx)
+
+		items := []models.Review{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to decode reviews"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ReviewPage{Items: items, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// CreateReview rates a movie, with an optional written review. A user can only review
+// a movie once; later changes go through UpdateReview. Text flagged by moderation is
+// held in the moderation queue and only shown to others once approved.
+func CreateReview(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.ReviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		imdbID := c.Param("imdb_id")
+		exists, err := movieExists(imdbID, client, ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+			return
+		}
+
+		now := time.Now()
+		review := models.Review{
+			ReviewID:  bson.NewObjectID().Hex(),
+			UserID:    userID,
+			ImdbID:    imdbID,
+			Rating:    req.Rating,
+			Text:      strings.TrimSpace(req.Text),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		var verdict models.ModerationVerdict
+		if review.Text != "" {
+			verdict = moderation.Check(ctx, review.Text)
+			review.ModerationStatus = reviewModerationStatus(verdict)
+		}
+
+		reviews := database.OpenCollection("reviews", client)
+		if _, err := reviews.InsertOne(ctx, review); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"Error": "You already reviewed this movie"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save review"})
+			return
+		}
+
+		if verdict.Flagged {
+			err = moderation.Hold(ctx, models.ModerationContentReview, review.ReviewID, userID, review.Text, verdict, client)
+		}
+		var rating *models.UserRating
+		if err == nil {
+			rating, err = updateUserRating(ctx, imdbID, int64(review.Rating), 1, client)
+		}
+		if err != nil {
+			// Take the review back, so the aggregate keeps matching the reviews
+			if _, err := reviews.DeleteOne(ctx, bson.M{"review_id": review.ReviewID}); err != nil {
+				log.Println("Failed to roll back review", review.ReviewID, ":", err)
+			}
+			if err := moderation.Withdraw(ctx, models.ModerationContentReview, review.ReviewID, client); err != nil {
+				log.Println("Failed to withdraw review", review.ReviewID, "from moderation:", err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to save review"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"review": review, "user_rating": rating})
+	}
+}
+
+// UpdateReview changes the rating and/or text of one of the current user's reviews.
+// New text goes through moderation again.
+func UpdateReview(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.ReviewUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		update := bson.M{"$set": set}
+		if req.Rating != nil {
+			set["rating"] = *req.Rating
+		}
+		var text string
+		var verdict models.ModerationVerdict
+		if req.Text != nil {
+			if text = strings.TrimSpace(*req.Text); text != "" {
+				verdict = moderation.Check(ctx, text)
+				set["text"] = text
+				set["moderation_status"] = reviewModerationStatus(verdict)
+				update["$unset"] = bson.M{"moderation_reason": ""}
+			} else {
+				update["$unset"] = bson.M{"text": "", "moderation_status": "", "moderation_reason": ""}
+			}
+		}
+
+		// The previous version gives the rating to take out of the aggregate
+		reviews := database.OpenCollection("reviews", client)
+		filter := bson.M{"review_id": c.Param("review_id"), "user_id": userID}
+		var previous models.Review
+		err = reviews.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&previous)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "Review not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update review"})
+			return
+		}
+
+		if req.Text != nil {
+			if verdict.Flagged {
+				err = moderation.Hold(ctx, models.ModerationContentReview, previous.ReviewID, userID, text, verdict, client)
+			} else {
+				err = moderation.Withdraw(ctx, models.ModerationContentReview, previous.ReviewID, client)
+			}
+		}
+		var rating *models.UserRating
+		if err == nil && req.Rating != nil && *req.Rating != previous.Rating {
+			rating, err = updateUserRating(ctx, previous.ImdbID, int64(*req.Rating-previous.Rating), 0, client)
+		}
+		if err != nil {
+			if _, err := reviews.ReplaceOne(ctx, bson.M{"review_id": previous.ReviewID}, previous); err != nil {
+				log.Println("Failed to roll back review", previous.ReviewID, ":", err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to update review"})
+			return
+		}
+
+		var updated models.Review
+		if err := reviews.FindOne(ctx, bson.M{"review_id": previous.ReviewID}).Decode(&updated); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch review"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"review": updated, "user_rating": rating})
+	}
+}
+
+// DeleteReview deletes one of the current user's reviews.
+func DeleteReview(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		reviews := database.OpenCollection("reviews", client)
+		var deleted models.Review
+		err = reviews.FindOneAndDelete(ctx, bson.M{"review_id": c.Param("review_id"), "user_id": userID}).Decode(&deleted)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"Error": "Review not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete review"})
+			return
+		}
+
+		rating, err := updateUserRating(ctx, deleted.ImdbID, -int64(deleted.Rating), -1, client)
+		if err != nil {
+			if _, err := reviews.InsertOne(ctx, deleted); err != nil {
+				log.Println("Failed to roll back deletion of review", deleted.ReviewID, ":", err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to delete review"})
+			return
+		}
+		if err := moderation.Withdraw(ctx, models.ModerationContentReview, deleted.ReviewID, client); err != nil {
+			log.Println("Failed to withdraw review", deleted.ReviewID, "from moderation:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Review deleted", "user_rating": rating})
+	}
+}
+
+// reviewModerationStatus is the moderation status of review text given its verdict.
+func reviewModerationStatus(verdict models.ModerationVerdict) string {
+	if verdict.Flagged {
+		return models.ModerationPending
+	}
+	return models.ModerationApproved
+}
+
+// updateUserRating adds to the rating sum and count of a movie and recomputes the
+// average, in a single update of the movie document so concurrent reviews cannot
+// overwrite each other. It returns the new aggregate.
+func updateUserRating(ctx context.Context, imdbID string, sumDelta, countDelta int64, client *mongo.Client) (*models.UserRating, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"user_rating.sum":   bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$user_rating.sum", 0}}, sumDelta}},
+			"user_rating.count": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$user_rating.count", 0}}, countDelta}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"user_rating.average": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$user_rating.count", 0}},
+				bson.M{"$round": bson.A{bson.M{"$divide": bson.A{"$user_rating.sum", "$user_rating.count"}}, 2}},
+				0,
+			}},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"_id": 0, "user_rating": 1})
+
+	var movie models.Movie
+	if err := database.OpenCollection("movies", client).FindOneAndUpdate(ctx, bson.M{"imdb_id": imdbID}, pipeline, opts).Decode(&movie); err != nil {
+		return nil, err
+	}
+	return movie.UserRating, nil
+}
@@ -2,14 +2,19 @@ package controllers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/eichiarakaki/magic-stream/database"
 	"github.com/eichiarakaki/magic-stream/models"
 	"github.com/eichiarakaki/magic-stream/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"golang.org/x/crypto/bcrypt"
@@ -23,15 +28,28 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
+// dummyPasswordHash is compared against when the email is unknown, so that
+// LoginUser spends the same bcrypt time whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("magic-stream-dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal("Failed to generate dummy password hash: ", err)
+	}
+	return string(hash)
+})
+
 // RegisterUser handles the registration of a new user.
 // It validates input data, checks for duplicate email addresses,
 // hashes the password, and inserts the user into the MongoDB collection.
+//
+// Only the fields of models.UserRegister are read from the request; the role,
+// identifiers, tokens and timestamps are always set by the server.
 func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		// Parse and bind the incoming JSON payload to the User model
-		var user models.User
-		if err := c.ShouldBindJSON(&user); err != nil {
+		// Parse and bind the incoming JSON payload to the registration DTO
+		var req models.UserRegister
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"Error":   "Invalid input data",
 				"details": err.Error(),
@@ -39,9 +57,11 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Validate the fields of the User struct using the validator library
-		validate := validator.New()
-		if err := validate.Struct(user); err != nil {
+		// Normalize the email so that uniqueness does not depend on case or stray spaces
+		req.Email = utils.NormalizeEmail(req.Email)
+
+		// Validate the fields of the request using the validator library
+		if err := validate.Struct(req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"Error":   "Validation failed",
 				"details": err.Error(),
@@ -50,7 +70,7 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 		}
 
 		// Hash the user's password before storing it
-		hashedPassword, err := HashPassword(user.Password)
+		hashedPassword, err := HashPassword(req.Password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"Error":   "Failed to hash password",
@@ -64,7 +84,7 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 		defer cancel()
 
 		// Ensure the email is unique by counting documents with the same email
-		count, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"email": user.Email})
+		count, err := database.OpenCollection("users", client).CountDocuments(ctx, bson.M{"email": req.Email})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"Error":   "Failed to check existing user",
@@ -79,14 +99,31 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Prepare the user object for database insertion
-		user.UserID = bson.NewObjectID().Hex()
-		user.Password = hashedPassword
-		user.CreatedAt = time.Now()
-		user.UpdatedAt = time.Now()
+		// Prepare the user object for database insertion, with server-assigned defaults
+		now := time.Now()
+		user := models.User{
+			UserID:         bson.NewObjectID().Hex(),
+			FirstName:      req.FirstName,
+			LastName:       req.LastName,
+			Email:          req.Email,
+			Password:       hashedPassword,
+			Role:           models.RoleUser,
+			EmailVerified:  false,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+			FavoriteGenres: req.FavoriteGenres,
+			SchemaVersion:  models.UserSchemaVersion,
+		}
 
 		// Insert the user into the MongoDB collection
 		result, err := database.OpenCollection("users", client).InsertOne(ctx, user)
+		if mongo.IsDuplicateKeyError(err) {
+			// Registered concurrently with the same email
+			c.JSON(http.StatusConflict, gin.H{
+				"Error": "User already exists",
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"Error":   "Failed to add user",
@@ -95,6 +132,9 @@ func RegisterUser(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
+		// Email the verification link without making the client wait for the mail server
+		go sendVerificationEmail(user, client)
+
 		// Return the insertion result to the client
 		c.JSON(http.StatusCreated, result)
 	}
@@ -121,86 +161,147 @@ func LoginUser(client *mongo.Client) gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
 		defer cancel()
 
+		// Refuse to even check the password while the account or the IP is locked out
+		accountKey, ipKey := utils.LoginAttemptKeys(userLogin.Email, c)
+		wait, err := utils.GetLoginLockout(accountKey, ipKey, client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"Error": "Failed to check login attempts",
+			})
+			return
+		}
+		if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"Error": "Too many failed login attempts, please try again later",
+			})
+			return
+		}
+
 		// Try to find the user in the database by email
 		var foundUser models.User
-		err := database.OpenCollection("users", client).FindOne(ctx, bson.M{"email": userLogin.Email}).Decode(&foundUser)
-		if err != nil {
-			// User was not found, or error occurred
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"Error": "Invalid email",
+		err = database.OpenCollection("users", client).FindOne(ctx, bson.M{"email": utils.NormalizeEmail(userLogin.Email)}).Decode(&foundUser)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"Error": "Failed to look up user",
 			})
 			return
 		}
+		userFound := err == nil
 
-		// Compare the provided password with the stored hashed password
-		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(userLogin.Password))
-		if err != nil {
+		// Compare the provided password with the stored hashed password.
+		// Unknown emails are compared against a dummy hash so that both cases take the same time.
+		passwordHash := dummyPasswordHash()
+		if userFound {
+			passwordHash = foundUser.Password
+		}
+		err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(userLogin.Password))
+		if err != nil || !userFound {
+			if err := utils.RecordLoginFailure(accountKey, ipKey, client, c); err != nil {
+				log.Println("Failed to record login failure:", err)
+			}
+			// Same message in both cases, so the response does not reveal which emails exist
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"Error": "Invalid password",
+				"Error": "Invalid email or password",
 			})
 			return
 		}
 
-		// Generate access and refresh tokens for the authenticated user
-		token, refreshToken, err := utils.GenerateAllTokens(
-			foundUser.Email,
-			foundUser.FirstName,
-			foundUser.LastName,
-			foundUser.Role,
-			foundUser.UserID,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"Error": "Failed to generate the tokens",
+		// Only checked once the password is known to be right, so it reveals nothing to others
+		if foundUser.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "This account has been disabled",
+			})
+			return
+		}
+		if !foundUser.EmailVerified && utils.GetUnverifiedAccountPolicy() == utils.UnverifiedBlock {
+			c.JSON(http.StatusForbidden, gin.H{
+				"Error": "Please verify your email address before logging in",
 			})
 			return
 		}
 
-		// Store the new tokens in the user's document in MongoDB
-		err = utils.UpdateAllTokens(token, refreshToken, foundUser.UserID, client, c)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"Error": "Failed to update the tokens",
+		// With two-factor authentication enabled the password alone does not open a session:
+		// the client gets a short-lived challenge token to send to /login/mfa with a code
+		if foundUser.TOTPEnabled {
+			mfaToken, err := utils.GenerateMFAChallengeToken(foundUser.UserID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"Error": "Failed to generate the MFA challenge",
+				})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaToken,
 			})
 			return
 		}
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "access_token",
-			Value:    token,
-			Path:     "/",
-			Domain:   "localhost",
-			MaxAge:   86400,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    refreshToken,
-			Path:     "/",
-			Domain:   "localhost",
-			MaxAge:   604800,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
+		startSession(c, client, foundUser, false)
+	}
+}
 
-		// Return user information and the generated tokens
-		c.JSON(http.StatusOK, models.UserResponse{
-			UserID:         foundUser.UserID,
-			FirstName:      foundUser.FirstName,
-			LastName:       foundUser.LastName,
-			Email:          foundUser.Email,
-			Role:           foundUser.Role,
-			FavoriteGenres: foundUser.FavoriteGenres,
-			//Token:          token,
-			//RefreshToken:   refreshToken,
+// startSession completes a successful login by opening a session and returning the user.
+func startSession(c *gin.Context, client *mongo.Client, foundUser models.User, mfa bool) {
+	if err := openSession(c, client, foundUser, mfa); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Error": err.Error(),
 		})
+		return
 	}
+
+	// Return user information and the generated tokens
+	c.JSON(http.StatusOK, models.UserResponse{
+		UserID:         foundUser.UserID,
+		FirstName:      foundUser.FirstName,
+		LastName:       foundUser.LastName,
+		Email:          foundUser.Email,
+		Role:           foundUser.Role,
+		FavoriteGenres: foundUser.FavoriteGenres,
+		//Token:          token,
+		//RefreshToken:   refreshToken,
+	})
 }
 
-// LogoutUser logs out ONLY the currently authenticated user.
+// openSession clears the failed login counter, opens a new session with its tokens
+// and sets the session cookies. The returned error is safe to show to the client.
+func openSession(c *gin.Context, client *mongo.Client, foundUser models.User, mfa bool) error {
+	accountKey, _ := utils.LoginAttemptKeys(foundUser.Email, c)
+	if err := utils.ResetLoginFailures(accountKey, client, c); err != nil {
+		log.Println("Failed to reset login failures:", err)
+	}
+
+	// Generate access and refresh tokens for a new session of the authenticated user
+	sessionID := bson.NewObjectID().Hex()
+	token, refreshToken, err := utils.GenerateAllTokens(
+		foundUser.Email,
+		foundUser.FirstName,
+		foundUser.LastName,
+		foundUser.Role,
+		foundUser.UserID,
+		sessionID,
+		mfa,
+	)
+	if err != nil {
+		return errors.New("Failed to generate the tokens")
+	}
+
+	// Store the session in the user's document in MongoDB, next to those of the user's other devices
+	err = utils.CreateSession(foundUser.UserID, sessionID, token, refreshToken, mfa, client, c)
+	if err != nil {
+		return errors.New("Failed to update the tokens")
+	}
+
+	utils.GetCookiePolicy().SetAuthCookies(c, token, refreshToken)
+	if err := issueCSRFToken(c, foundUser.UserID); err != nil {
+		return errors.New("Failed to generate the CSRF token")
+	}
+
+	return nil
+}
+
+// LogoutUser ends ONLY the current session of the authenticated user.
 func LogoutUser(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDValue, exists := c.Get("user_id")
@@ -214,9 +315,8 @@ func LogoutUser(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Remove tokens in database
-		// Passing empty strings "" means: no valid tokens stored
-		err := utils.UpdateAllTokens("", "", userID, client, c)
+		// End this session in the database; the user's other devices stay signed in
+		err := utils.EndSession(userID, utils.GetSessionIDFromContext(c), client, c)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Error logging out",
@@ -225,17 +325,8 @@ func LogoutUser(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Delete the access token cookie in the browser.
-		// MaxAge: -1 tells the browser to immediately remove the cookie.
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "access_token",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1, // expire immediately
-			Secure:   true,
-			HttpOnly: true, // JS cannot read the cookie
-			SameSite: http.SameSiteLaxMode,
-		})
+		// Delete the session cookies in the browser, using the same attributes they were set with.
+		utils.GetCookiePolicy().ClearAuthCookies(c)
 
 		// Final response to the client
 		c.JSON(http.StatusOK, gin.H{
@@ -249,7 +340,8 @@ func RefreshTokenHandler(client *mongo.Client) gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
 		defer cancel()
 
-		refreshToken, err := c.Cookie("refresh_token")
+		policy := utils.GetCookiePolicy()
+		refreshToken, err := policy.Cookie(c, utils.RefreshTokenCookie)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to retrieve refresh token from cookie"})
 			return
@@ -269,17 +361,51 @@ func RefreshTokenHandler(client *mongo.Client) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
 		}
+		// Only the latest refresh token of an open session is valid; sessions end on logout,
+		// password reset, force-logout and when the account is disabled
+		session := utils.FindSession(&user, claim.SessionID)
+		if user.Disabled || session == nil || subtle.ConstantTimeCompare([]byte(session.RefreshTokenHash), []byte(utils.HashSessionToken(refreshToken))) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
 
-		newToken, newRefreshToken, _ := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Role, user.UserID)
-		err = utils.UpdateAllTokens(newToken, newRefreshToken, user.UserID, client, c)
+		newToken, newRefreshToken, err := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Role, user.UserID, session.SessionID, session.MFA)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate the tokens"})
+			return
+		}
+		rotated, err := utils.RotateSession(user.UserID, session.SessionID, refreshToken, newToken, newRefreshToken, client, c)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the tokens"})
 			return
 		}
+		// Another request refreshed the session first, or it ended meanwhile
+		if !rotated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
 
-		c.SetCookie("access_token", newToken, 86400, "/", "localhost", true, true)
-		c.SetCookie("refresh_token", newRefreshToken, 604800, "/", "localhost", true, true)
+		policy.SetAuthCookies(c, newToken, newRefreshToken)
+		if err := issueCSRFToken(c, user.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate the CSRF token"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Successfully refreshed the tokens"})
 	}
 }
+
+// issueCSRFToken sets a fresh double-submit CSRF token for the user.
+// The cookie is readable by JavaScript (not HttpOnly) and the token is also returned
+// in the X-CSRF-Token header for clients that cannot read cookies of the API origin.
+func issueCSRFToken(c *gin.Context, userID string) error {
+	csrfToken, err := utils.GenerateCSRFToken(userID)
+	if err != nil {
+		return err
+	}
+
+	utils.GetCookiePolicy().SetCSRFCookie(c, csrfToken)
+	c.Header(utils.CSRFHeaderName, csrfToken)
+
+	return nil
+}
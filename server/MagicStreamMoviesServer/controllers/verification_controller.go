@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/mailer"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// emailVerificationTTL is how long an email verification link stays valid.
+const emailVerificationTTL = 24 * time.Hour
+
+// VerifyEmail marks the user's email as verified using the token sent at registration.
+func VerifyEmail(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		var req models.VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		token, err := utils.ConsumeOneTimeToken(req.Token, models.TokenPurposeEmailVerification, client, c)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidOneTimeToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check verification token"})
+			return
+		}
+
+		now := time.Now()
+		update := bson.M{"$set": bson.M{
+			"email_verified":    true,
+			"email_verified_at": now,
+			"updated_at":        now,
+		}}
+		result, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": token.UserID}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to verify email"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": utils.ErrInvalidOneTimeToken.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+	}
+}
+
+// ResendVerificationEmail sends a new verification link. Like ForgotPassword it always
+// gives the same answer so it cannot be used to find out which emails are registered.
+func ResendVerificationEmail(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ResendVerificationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data"})
+			return
+		}
+		req.Email = utils.NormalizeEmail(req.Email)
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+			defer cancel()
+
+			var user models.User
+			filter := bson.M{"email": req.Email, "email_verified": bson.M{"$ne": true}}
+			err := database.OpenCollection("users", client).FindOne(ctx, filter).Decode(&user)
+			if err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) {
+					log.Println("Email verification: failed to look up user:", err)
+				}
+				return
+			}
+			sendVerificationEmail(user, client)
+		}()
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "If an unverified account exists for this email, a verification link has been sent",
+		})
+	}
+}
+
+// sendVerificationEmail issues a verification token and emails the link to the user.
+// It runs in the background, so errors are only logged.
+func sendVerificationEmail(user models.User, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	rawToken, err := utils.IssueOneTimeToken(user.UserID, models.TokenPurposeEmailVerification, emailVerificationTTL, client, ctx)
+	if err != nil {
+		log.Println("Email verification: failed to issue token:", err)
+		return
+	}
+
+	verifyURL := os.Getenv("EMAIL_VERIFICATION_URL")
+	if verifyURL == "" {
+		verifyURL = "https://localhost:5173/verify-email"
+	}
+	link := verifyURL + "?token=" + url.QueryEscape(rawToken)
+
+	err = mailer.Default().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your MagicStream email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Welcome to MagicStream! Please confirm your email address within 24 hours:\n\n" +
+			link + "\n",
+	})
+	if err != nil {
+		log.Println("Email verification: failed to send email:", err)
+	}
+}
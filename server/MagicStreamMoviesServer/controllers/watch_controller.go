@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// watchFinishedProgress is the share of a movie after which it counts as watched (end credits are skipped).
+	watchFinishedProgress = 0.95
+	// watchRewatchWindow is how long repeated "finished" heartbeats are taken as the same viewing.
+	watchRewatchWindow = 6 * time.Hour
+	// defaultContinueWatchingLimit is the number of titles returned by GetContinueWatching by default.
+	defaultContinueWatchingLimit = 20
+)
+
+// watchDebouncer limits progress writes to one per user, movie and WATCH_HEARTBEAT_INTERVAL (30s by default).
+var watchDebouncer = sync.OnceValue(func() *utils.Debouncer {
+	return utils.NewDebouncer(utils.DurationFromEnv("WATCH_HEARTBEAT_INTERVAL", 30*time.Second))
+})
+
+// RecordWatchProgress stores a progress heartbeat from the player.
+//
+// Players may send heartbeats as often as they like: in-between ones are acknowledged
+// but not written (recorded: false). Heartbeats that finish the movie are always written.
+func RecordWatchProgress(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		var req models.WatchProgressRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid input data", "details": err.Error()})
+			return
+		}
+		if err := validate.Struct(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Validation failed", "details": err.Error()})
+			return
+		}
+
+		position := min(req.Position, req.Duration)
+		progress := position / req.Duration
+		finished := progress >= watchFinishedProgress
+
+		now := time.Now()
+		key := userID + "|" + req.ImdbID
+		if !finished && !watchDebouncer().Allow(key, now) {
+			c.JSON(http.StatusAccepted, gin.H{"recorded": false})
+			return
+		}
+
+		exists, err := movieExists(req.ImdbID, client, ctx)
+		if err != nil {
+			// The heartbeat was not written, so the next one must not be dropped
+			watchDebouncer().Reset(key)
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to check movie"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "Movie not found"})
+			return
+		}
+
+		event := models.WatchEvent{
+			UserID:          userID,
+			ImdbID:          req.ImdbID,
+			PositionSeconds: position,
+			DurationSeconds: req.Duration,
+			Progress:        progress,
+			Finished:        finished,
+			UpdatedAt:       now,
+		}
+
+		var recorded bool
+		if finished {
+			recorded, err = finishWatchEvent(ctx, event, client)
+		} else {
+			err = updateWatchEvent(ctx, event, client)
+			recorded = err == nil
+		}
+		if err != nil {
+			log.Println("Failed to record watch progress:", err)
+			watchDebouncer().Reset(key)
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to record progress"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"recorded": recorded, "progress": progress, "finished": finished})
+	}
+}
+
+// updateWatchEvent moves the current (unfinished) viewing forward, starting one if needed.
+func updateWatchEvent(ctx context.Context, event models.WatchEvent, client *mongo.Client) error {
+	filter := bson.M{"user_id": event.UserID, "imdb_id": event.ImdbID, "finished": false}
+	update := bson.M{
+		"$set": bson.M{
+			"position_seconds": event.PositionSeconds,
+			"duration_seconds": event.DurationSeconds,
+			"progress":         event.Progress,
+			"updated_at":       event.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{"started_at": event.UpdatedAt},
+	}
+
+	watchEvents := database.OpenCollection("watch_events", client)
+	_, err := watchEvents.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Another heartbeat started the viewing at the same time; update it instead
+		_, err = watchEvents.UpdateOne(ctx, filter, update)
+	}
+	return err
+}
+
+// finishWatchEvent marks the current viewing as finished. Players keep sending heartbeats
+// at the end of a movie, so if the last viewing already finished recently nothing is written.
+func finishWatchEvent(ctx context.Context, event models.WatchEvent, client *mongo.Client) (bool, error) {
+	watchEvents := database.OpenCollection("watch_events", client)
+
+	set := bson.M{
+		"position_seconds": event.PositionSeconds,
+		"duration_seconds": event.DurationSeconds,
+		"progress":         event.Progress,
+		"finished":         true,
+		"finished_at":      event.UpdatedAt,
+		"updated_at":       event.UpdatedAt,
+	}
+	result, err := watchEvents.UpdateOne(ctx,
+		bson.M{"user_id": event.UserID, "imdb_id": event.ImdbID, "finished": false},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		watchDebouncer().Reset(event.UserID + "|" + event.ImdbID)
+		return true, nil
+	}
+
+	// No viewing in progress: either this one was already recorded, or the user jumped straight to the end
+	recent, err := watchEvents.CountDocuments(ctx, bson.M{
+		"user_id":     event.UserID,
+		"imdb_id":     event.ImdbID,
+		"finished_at": bson.M{"$gte": event.UpdatedAt.Add(-watchRewatchWindow)},
+	})
+	if err != nil || recent > 0 {
+		return false, err
+	}
+
+	finishedAt := event.UpdatedAt
+	event.StartedAt = event.UpdatedAt
+	event.FinishedAt = &finishedAt
+	if _, err := watchEvents.InsertOne(ctx, event); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetContinueWatching returns the titles the user started but did not finish, most recent first.
+// ?limit= sets the number of titles (default 20, max 100).
+func GetContinueWatching(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		limit := int64(defaultContinueWatchingLimit)
+		if value := c.Query("limit"); value != "" {
+			limit, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || limit < 1 || limit > utils.MaxPageSize {
+				c.JSON(http.StatusBadRequest, gin.H{"Error": "limit must be between 1 and " + strconv.Itoa(utils.MaxPageSize)})
+				return
+			}
+		}
+
+		events, err := findWatchEvents(ctx, bson.M{"user_id": userID, "finished": false}, 0, limit, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch watch progress"})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+// GetWatchHistory returns every viewing of the user, most recent first, paginated.
+func GetWatchHistory(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+		defer cancel()
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+
+		page, pageSize, err := utils.GetPagination(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+
+		filter := bson.M{"user_id": userID}
+		total, err := database.OpenCollection("watch_events", client).CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to count watch history"})
+			return
+		}
+
+		events, err := findWatchEvents(ctx, filter, (page-1)*pageSize, pageSize, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to fetch watch history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.WatchHistoryPage{Items: events, Page: page, PageSize: pageSize, Total: total})
+	}
+}
+
+// findWatchEvents returns watch events, most recent first, with the title and poster of their movie.
+func findWatchEvents(ctx context.Context, filter bson.M, skip, limit int64, client *mongo.Client) ([]models.WatchEvent, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$skip", Value: skip}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "movies",
+			"localField":   "imdb_id",
+			"foreignField": "imdb_id",
+			"as":           "movie",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"_id": 0, "title": 1, "poster_path": 1, "youtube_id": 1}}},
+		}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$movie", "preserveNullAndEmptyArrays": true}}},
+	}
+
+	cursor, err := database.OpenCollection("watch_events", client).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	events := []models.WatchEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// movieExists reports whether a movie with the IMDb ID is in the catalogue.
+func movieExists(imdbID string, client *mongo.Client, ctx context.Context) (bool, error) {
+	count, err := database.OpenCollection("movies", client).CountDocuments(ctx, bson.M{"imdb_id": imdbID}, options.Count().SetLimit(1))
+	return count > 0, err
+}
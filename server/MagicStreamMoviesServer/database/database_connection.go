@@ -37,9 +37,8 @@ func Connect() *mongo.Client {
 		log.Fatal(err)
 	}
 
-	fmt.Println("Successfully connected to MongoDB!")
+	log.Println("Successfully connected to MongoDB!")
 	//fmt.Println("MONGODB_DATABASE: ", MongoDB)
-	fmt.Println("MONGODB_URI: ", MongoURI)
 
 	return client
 }
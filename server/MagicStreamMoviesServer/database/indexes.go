@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the server relies on. Creating an index that
+// already exists is a no-op, so this is safe to run on every start.
+func EnsureIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	indexes := map[string][]mongo.IndexModel{
+		"api_keys": {
+			{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		"audit_logs": {
+			{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		"erasure_reports": {
+			{Keys: bson.D{{Key: "report_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "started_at", Value: -1}}},
+		},
+		"experiments": {
+			{Keys: bson.D{{Key: "experiment_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			// At most one running experiment
+			{
+				Keys: bson.D{{Key: "status", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"status": "running"}),
+			},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+		"jobs": {
+			{Keys: bson.D{{Key: "job_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "type", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "started_at", Value: -1}}},
+		},
+		"login_attempts": {
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			// Failures are forgotten after an hour anyway; let MongoDB clean up idle entries
+			{Keys: bson.D{{Key: "last_failure_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(86400)},
+		},
+		"moderation_queue": {
+			{Keys: bson.D{{Key: "item_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Keys: bson.D{{Key: "content_type", Value: 1}, {Key: "content_id", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		},
+		"movie_embeddings": {
+			{Keys: bson.D{{Key: "imdb_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "model", Value: 1}}},
+		},
+		"movies": {
+			// Imports upsert by imdb_id, and must not race AddMovie into duplicates
+			{Keys: bson.D{{Key: "imdb_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "release_year", Value: 1}}},
+			{Keys: bson.D{{Key: "schema_version", Value: 1}}},
+		},
+		"one_time_tokens": {
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+			// Let MongoDB delete tokens a day after they expire
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(86400)},
+		},
+		"recommendations": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "computed_at", Value: 1}}},
+		},
+		"recommendation_impressions": {
+			{Keys: bson.D{{Key: "experiment_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "imdb_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "imdb_id", Value: 1}, {Key: "last_shown_at", Value: -1}}},
+		},
+		"reviews": {
+			{Keys: bson.D{{Key: "review_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			// One review per user and movie
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "imdb_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Keys: bson.D{{Key: "imdb_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "imdb_id", Value: 1}, {Key: "rating", Value: -1}, {Key: "created_at", Value: -1}}},
+		},
+		"user_lists": {
+			{Keys: bson.D{{Key: "list_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			// One watchlist per user
+			{
+				Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "kind", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"kind": "watchlist"}),
+			},
+			{
+				Keys: bson.D{{Key: "share_token_hash", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"share_token_hash": bson.M{"$exists": true}}),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		},
+		"users": {
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}}, // Admin user listing
+			// One account per identity at the OIDC provider; accounts without one are not indexed
+			{
+				Keys: bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"oidc_subject": bson.M{"$exists": true}}),
+			},
+		},
+		"watch_events": {
+			// At most one viewing in progress per user and movie
+			{
+				Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "imdb_id", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"finished": false}),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "finished", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "imdb_id", Value: 1}, {Key: "finished_at", Value: -1}}},
+		},
+	}
+
+	// movies.imdb_id used to be indexed without being unique
+	if err := prepareUniqueIndex(ctx, OpenCollection("movies", client), "imdb_id"); err != nil {
+		return err
+	}
+
+	for collectionName, models := range indexes {
+		if _, err := OpenCollection(collectionName, client).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepareUniqueIndex makes way for a unique index on field: it fails while documents
+// share a value, listing some of them, and drops an existing non-unique index on the field.
+func prepareUniqueIndex(ctx context.Context, collection *mongo.Collection, field string) error {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 10}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Value any   `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		values := make([]string, len(duplicates))
+		for i, duplicate := range duplicates {
+			values[i] = fmt.Sprintf("%v (%d documents)", duplicate.Value, duplicate.Count)
+		}
+		return fmt.Errorf("%s.%s must be unique; remove the duplicates of %v", collection.Name(), field, values)
+	}
+
+	specifications, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	for _, specification := range specifications {
+		var keys bson.D
+		if err := bson.Unmarshal(specification.KeysDocument, &keys); err != nil {
+			return err
+		}
+		unique := specification.Unique != nil && *specification.Unique
+		if len(keys) == 1 && keys[0].Key == field && !unique {
+			log.Printf("Dropping the non-unique index %s of %s to make it unique", specification.Name, collection.Name())
+			if err := collection.Indexes().DropOne(ctx, specification.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package discovery finds movies from a natural language query such as
+// "a feel-good sci-fi with great reviews". The language model translates the query
+// into a filter over the catalog; when it cannot, the query is searched as keywords.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/llm"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrUnusable is returned when the model's answer cannot be turned into a filter.
+var ErrUnusable = errors.New("discovery: unusable filter")
+
+// Vocabulary is what filters may refer to: the genres and rankings of the catalog.
+type Vocabulary struct {
+	Genres   []models.Genre
+	Rankings []models.Ranking
+}
+
+// Discover answers a query with up to limit movies. The model gets DISCOVERY_LLM_TIMEOUT
+// (default 15s) to answer before the keyword search is used instead.
+func Discover(ctx context.Context, query string, limit int, client *mongo.Client) (*models.DiscoveryResponse, error) {
+	vocabulary, err := LoadVocabulary(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	source := models.DiscoverySourceLLM
+	filter, err := translateWithTimeout(ctx, query, vocabulary)
+	if err != nil {
+		log.Println("Falling back to keyword discovery:", err)
+		source = models.DiscoverySourceKeywords
+		filter = KeywordFilter(query, vocabulary)
+	}
+
+	movies, err := Search(ctx, filter, vocabulary, limit, client)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DiscoveryResponse{Query: query, Source: source, Filter: filter, Items: movies}, nil
+}
+
+func translateWithTimeout(ctx context.Context, query string, vocabulary *Vocabulary) (models.DiscoveryFilter, error) {
+	ctx, cancel := context.WithTimeout(ctx, utils.DurationFromEnv("DISCOVERY_LLM_TIMEOUT", 15*time.Second))
+	defer cancel()
+
+	llmClient, err := llm.Default(ctx)
+	if err != nil {
+		return models.DiscoveryFilter{}, err
+	}
+	return Translate(ctx, llmClient, query, vocabulary)
+}
+
+// LoadVocabulary reads the genres and rankings collections.
+func LoadVocabulary(ctx context.Context, client *mongo.Client) (*Vocabulary, error) {
+	var vocabulary Vocabulary
+	if err := findAll(ctx, "genres", &vocabulary.Genres, client); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, "rankings", &vocabulary.Rankings, client); err != nil {
+		return nil, err
+	}
+	return &vocabulary, nil
+}
+
+func findAll[T any](ctx context.Context, collection string, results *[]T, client *mongo.Client) error {
+	cursor, err := database.OpenCollection(collection, client).Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
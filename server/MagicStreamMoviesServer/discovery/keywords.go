@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+const (
+	minKeywordLength = 3
+	maxKeywords      = 5
+
+	minYear = 1888
+	maxYear = 2100
+)
+
+// decade matches "1990s", "90s" and "'90s".
+var decade = regexp.MustCompile(`^(?:(1[89]|20)?([0-9])0)s$`)
+
+// stopWords are left out of keyword searches.
+var stopWords = []string{
+	"the", "and", "for", "with", "from", "that", "this", "about", "some", "something",
+	"movie", "movies", "film", "films", "show", "want", "watch", "like", "good", "best",
+	"any", "are", "was", "were", "has", "have", "not", "but", "its", "into", "one",
+}
+
+// KeywordFilter turns a query into a filter without the model: genre names found in the
+// query become genres, and decades ("90s") or years a release year range. Without genres,
+// the other words become keywords; with genres they are left out, as words like
+// "feel-good" would rarely be in a title or review.
+func KeywordFilter(query string, vocabulary *Vocabulary) models.DiscoveryFilter {
+	filter := models.DiscoveryFilter{Sort: models.DiscoverySortRanking}
+	rest := strings.ToLower(query)
+
+	// Genre names first, as they may have several words or hyphens ("Sci-Fi")
+	for _, genre := range vocabulary.Genres {
+		name := strings.ToLower(genre.GenreName)
+		if i := indexWord(rest, name); i >= 0 {
+			filter.Genres = appendUnique(filter.Genres, genre.GenreName)
+			rest = rest[:i] + " " + rest[i+len(name):]
+		}
+	}
+
+	words := strings.FieldsFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for _, word := range words {
+		if len(word) < minKeywordLength || slices.Contains(stopWords, word) {
+			continue
+		}
+		if from, to, ok := yearRange(word); ok {
+			filter.YearFrom, filter.YearTo = from, to
+			continue
+		}
+		// "comedies" or "thrillers"
+		if genre, ok := vocabulary.pluralGenre(word); ok {
+			filter.Genres = appendUnique(filter.Genres, genre)
+			continue
+		}
+		if len(filter.Keywords) < maxKeywords {
+			filter.Keywords = appendUnique(filter.Keywords, word)
+		}
+	}
+	if len(filter.Genres) > 0 {
+		filter.Keywords = nil
+	}
+	return filter
+}
+
+// yearRange reads a decade or a year.
+func yearRange(word string) (from, to int, ok bool) {
+	if match := decade.FindStringSubmatch(word); match != nil {
+		century := 1900
+		switch match[1] {
+		case "18":
+			century = 1800
+		case "20":
+			century = 2000
+		case "":
+			// "20s" is the 1920s, but "00s" and "10s" are this century
+			if match[2] == "0" || match[2] == "1" {
+				century = 2000
+			}
+		}
+		from = century + int(match[2][0]-'0')*10
+		return from, from + 9, from >= minYear
+	}
+	if len(word) == 4 {
+		if year, err := strconv.Atoi(word); err == nil && year >= minYear && year <= maxYear {
+			return year, year, true
+		}
+	}
+	return 0, 0, false
+}
+
+// indexWord finds word in text where it is not part of a longer word.
+func indexWord(text, word string) int {
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return -1
+		}
+		start, end := offset+i, offset+i+len(word)
+		if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+			return start
+		}
+		offset = start + 1
+	}
+	return -1
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+func (v *Vocabulary) pluralGenre(word string) (string, bool) {
+	for _, genre := range v.Genres {
+		name := strings.ToLower(genre.GenreName)
+		if word == name+"s" || strings.HasSuffix(name, "y") && word == strings.TrimSuffix(name, "y")+"ies" {
+			return genre.GenreName, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Search runs a filter against the movies collection.
+func Search(ctx context.Context, filter models.DiscoveryFilter, vocabulary *Vocabulary, limit int, client *mongo.Client) ([]models.Movie, error) {
+	opts := options.Find().SetSort(sortOrder(filter.Sort)).SetLimit(int64(limit))
+	cursor, err := database.OpenCollection("movies", client).Find(ctx, Query(filter, vocabulary), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	movies := []models.Movie{}
+	if err := cursor.All(ctx, &movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// Query builds the MongoDB filter of a discovery filter.
+func Query(filter models.DiscoveryFilter, vocabulary *Vocabulary) bson.M {
+	query := bson.M{}
+
+	genres := bson.M{}
+	if len(filter.Genres) > 0 {
+		genres["$in"] = filter.Genres
+	}
+	if len(filter.ExcludeGenres) > 0 {
+		genres["$nin"] = filter.ExcludeGenres
+	}
+	if len(genres) > 0 {
+		query["genre.genre_name"] = genres
+	}
+
+	if len(filter.Keywords) > 0 {
+		var keywords bson.A
+		for _, keyword := range filter.Keywords {
+			pattern := bson.Regex{Pattern: regexp.QuoteMeta(keyword), Options: "i"}
+			keywords = append(keywords, bson.M{"title": pattern}, bson.M{"admin_review": pattern})
+		}
+		query["$or"] = keywords
+	}
+
+	if ranking, ok := vocabulary.ranking(filter.MinRanking); ok {
+		// Lower values are better; 0 and 999 mean not ranked
+		query["ranking.ranking_value"] = bson.M{"$gt": 0, "$lte": ranking.RankingValue}
+	}
+	if filter.MinUserRating > 0 {
+		query["user_rating.average"] = bson.M{"$gte": filter.MinUserRating}
+	}
+
+	years := bson.M{}
+	if filter.YearFrom > 0 {
+		years["$gte"] = filter.YearFrom
+	}
+	if filter.YearTo > 0 {
+		years["$lte"] = filter.YearTo
+	}
+	if len(years) > 0 {
+		query["release_year"] = years
+	}
+	if filter.MaxRuntime > 0 {
+		query["runtime_minutes"] = bson.M{"$gt": 0, "$lte": filter.MaxRuntime}
+	}
+	if len(filter.AgeRatings) > 0 {
+		query["age_rating"] = bson.M{"$in": filter.AgeRatings}
+	}
+	if len(filter.Languages) > 0 {
+		query["languages"] = bson.M{"$in": filter.Languages}
+	}
+	return query
+}
+
+func sortOrder(sort string) bson.D {
+	switch sort {
+	case models.DiscoverySortUserRating:
+		return bson.D{{Key: "user_rating.average", Value: -1}, {Key: "imdb_id", Value: 1}}
+	case models.DiscoverySortTitle:
+		return bson.D{{Key: "title", Value: 1}, {Key: "imdb_id", Value: 1}}
+	default:
+		return bson.D{{Key: "ranking.ranking_value", Value: 1}, {Key: "imdb_id", Value: 1}}
+	}
+}
@@ -0,0 +1,54 @@
+// Package embedding turns movies into vectors, stores them in the movie_embeddings
+// collection and finds similar movies by cosine similarity.
+package embedding
+
+import (
+	"context"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// Embedder computes one vector per text. Vectors from different models are not
+// comparable, so each embedder names its vector space with Model.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+}
+
+// Default returns the embedder selected by EMBEDDING_PROVIDER: "gemini" (default)
+// or "hashing", which needs no network and always gives the same vectors.
+var Default = sync.OnceValue(func() Embedder {
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "", "gemini":
+		return NewGemini()
+	case "hashing":
+		return NewHashing(DefaultHashingDimensions)
+	default:
+		log.Printf("Warning: unknown EMBEDDING_PROVIDER %q, using hashing", provider)
+		return NewHashing(DefaultHashingDimensions)
+	}
+})
+
+// movieTextLabel matches the labels MovieText starts its lines with.
+var movieTextLabel = regexp.MustCompile(`(?m)^(?:Title|Genres|Review): `)
+
+// MovieText is the text a movie is embedded from.
+func MovieText(movie *models.Movie) string {
+	genres := make([]string, 0, len(movie.Genre))
+	for _, genre := range movie.Genre {
+		genres = append(genres, genre.GenreName)
+	}
+
+	var text strings.Builder
+	text.WriteString("Title: " + movie.Title + "\n")
+	text.WriteString("Genres: " + strings.Join(genres, ", ") + "\n")
+	if movie.AdminReview != "" {
+		text.WriteString("Review: " + movie.AdminReview + "\n")
+	}
+	return text.String()
+}
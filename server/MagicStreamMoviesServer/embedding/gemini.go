@@ -0,0 +1,86 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+const (
+	defaultGeminiModel      = "gemini-embedding-001"
+	defaultGeminiDimensions = 768
+)
+
+// Gemini embeds text with the Gemini API (GEMINI_API_KEY). EMBEDDING_MODEL and
+// EMBEDDING_DIMENSIONS override the model and the vector size.
+type Gemini struct {
+	model      string
+	dimensions int32
+
+	mu     sync.Mutex
+	client *genai.Client
+}
+
+func NewGemini() *Gemini {
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	dimensions := int32(defaultGeminiDimensions)
+	if value, err := strconv.Atoi(os.Getenv("EMBEDDING_DIMENSIONS")); err == nil && value > 0 {
+		dimensions = int32(value)
+	}
+	return &Gemini{model: model, dimensions: dimensions}
+}
+
+func (g *Gemini) Model() string {
+	return fmt.Sprintf("gemini:%s/%d", g.model, g.dimensions)
+}
+
+func (g *Gemini) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	client, err := g.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([]*genai.Content, 0, len(texts))
+	for _, text := range texts {
+		contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+	}
+	response, err := client.Models.EmbedContent(ctx, g.model, contents, &genai.EmbedContentConfig{
+		TaskType:             "SEMANTIC_SIMILARITY",
+		OutputDimensionality: &g.dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding: got %d vectors for %d texts", len(response.Embeddings), len(texts))
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for _, embedding := range response.Embeddings {
+		// Truncated Gemini vectors are not normalized
+		vectors = append(vectors, normalize(embedding.Values))
+	}
+	return vectors, nil
+}
+
+// connect creates the client on first use, and again after a failure.
+func (g *Gemini) connect(ctx context.Context) (*genai.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.client == nil {
+		client, err := genai.NewClient(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		g.client = client
+	}
+	return g.client, nil
+}
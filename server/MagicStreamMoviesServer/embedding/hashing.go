@@ -0,0 +1,85 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// DefaultHashingDimensions is the vector size of the hashing embedder.
+const DefaultHashingDimensions = 256
+
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Hashing is a local embedder: words and word pairs are hashed into a fixed number
+// of dimensions (the "hashing trick"). It only captures shared vocabulary, not meaning,
+// but is deterministic and works offline, e.g. in development and tests.
+type Hashing struct {
+	Dimensions int
+}
+
+func NewHashing(dimensions int) *Hashing {
+	return &Hashing{Dimensions: dimensions}
+}
+
+// Model names the vector space. v2 stopped hashing the labels of MovieText.
+func (h *Hashing) Model() string {
+	return fmt.Sprintf("hashing/v2/%d", h.Dimensions)
+}
+
+func (h *Hashing) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, h.embed(text))
+	}
+	return vectors, nil
+}
+
+func (h *Hashing) embed(text string) []float32 {
+	// The labels are in every movie's text, so hashing them would give all movies a
+	// positive similarity
+	text = movieTextLabel.ReplaceAllString(text, "")
+	tokens := tokenPattern.FindAllString(strings.ToLower(text), -1)
+
+	counts := map[string]int{}
+	for i, token := range tokens {
+		counts[token]++
+		if i > 0 {
+			counts[tokens[i-1]+" "+token]++
+		}
+	}
+
+	vector := make([]float32, h.Dimensions)
+	for feature, count := range counts {
+		hasher := fnv.New64a()
+		_, _ = hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+
+		// One bit of the hash gives the sign, so that collisions cancel out on average
+		weight := float32(1 + math.Log(float64(count)))
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		vector[sum%uint64(h.Dimensions)] += weight
+	}
+	return normalize(vector)
+}
+
+// normalize scales a vector to unit length, so that cosine similarity is a dot product.
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
@@ -0,0 +1,182 @@
+package embedding
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+)
+
+const (
+	// Below this many vectors, a full scan is as fast as the index and exact.
+	bruteForceBelow = 10000
+
+	lshTables = 16
+	// lshBucketSize is the average number of vectors per bucket the number of bits aims at
+	lshBucketSize = 32
+	lshSeed       = 42
+)
+
+// Match is a movie found by the index.
+type Match struct {
+	ImdbID     string
+	Similarity float64
+}
+
+// Index finds the nearest vectors by cosine similarity. Large catalogues use random
+// hyperplane LSH: each table hashes a vector to the side of a few random hyperplanes
+// it falls on, so that close vectors tend to share a bucket. Candidates from the query's
+// buckets (and the buckets one bit away) are then ranked exactly.
+type Index struct {
+	mu       sync.RWMutex
+	ids      []string
+	vectors  [][]float32 // Unit length
+	position map[string]int
+
+	planes [][][]float32 // [table][bit] hyperplane normal
+	tables []map[uint32][]int
+}
+
+// NewIndex indexes vectors, which must be of unit length and all of the same size.
+func NewIndex(ids []string, vectors [][]float32) *Index {
+	index := &Index{ids: ids, vectors: vectors, position: make(map[string]int, len(ids))}
+	for i, id := range ids {
+		index.position[id] = i
+	}
+	if len(vectors) < bruteForceBelow {
+		return index
+	}
+
+	dimensions := len(vectors[0])
+	bits := int(math.Round(math.Log2(float64(len(vectors)) / lshBucketSize)))
+	bits = max(4, min(bits, 24))
+	random := rand.New(rand.NewSource(lshSeed))
+	index.planes = make([][][]float32, lshTables)
+	index.tables = make([]map[uint32][]int, lshTables)
+	for t := range index.planes {
+		index.planes[t] = make([][]float32, bits)
+		for b := range index.planes[t] {
+			plane := make([]float32, dimensions)
+			for d := range plane {
+				plane[d] = float32(random.NormFloat64())
+			}
+			index.planes[t][b] = plane
+		}
+
+		index.tables[t] = map[uint32][]int{}
+		for i, vector := range vectors {
+			signature := index.signature(t, vector)
+			index.tables[t][signature] = append(index.tables[t][signature], i)
+		}
+	}
+	return index
+}
+
+// Len is the number of indexed vectors.
+func (index *Index) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return len(index.ids)
+}
+
+// Add indexes a vector, replacing the one indexed for id if any. Vectors of another size
+// than the hyperplanes are ignored, as Nearest could not compare them.
+func (index *Index) Add(id string, vector []float32) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if index.tables != nil && len(vector) != len(index.planes[0][0]) {
+		return
+	}
+	i, found := index.position[id]
+	if found {
+		for t := range index.tables {
+			signature := index.signature(t, index.vectors[i])
+			index.tables[t][signature] = slices.DeleteFunc(index.tables[t][signature], func(j int) bool { return j == i })
+		}
+		index.vectors[i] = vector
+	} else {
+		i = len(index.ids)
+		index.ids = append(index.ids, id)
+		index.vectors = append(index.vectors, vector)
+		index.position[id] = i
+	}
+	for t := range index.tables {
+		signature := index.signature(t, vector)
+		index.tables[t][signature] = append(index.tables[t][signature], i)
+	}
+}
+
+// Nearest returns the k most similar vectors with a positive similarity, leaving out exclude.
+func (index *Index) Nearest(vector []float32, k int, exclude string) []Match {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var candidates []int
+	if index.tables != nil && len(vector) != len(index.planes[0][0]) {
+		return nil
+	}
+	if index.tables == nil {
+		candidates = make([]int, len(index.ids))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	} else {
+		seen := map[int]bool{}
+		for t := range index.tables {
+			signature := index.signature(t, vector)
+			// Multi-probe: also look in the buckets one hyperplane away
+			for flip := -1; flip < len(index.planes[t]); flip++ {
+				probe := signature
+				if flip >= 0 {
+					probe ^= 1 << flip
+				}
+				for _, i := range index.tables[t][probe] {
+					if !seen[i] {
+						seen[i] = true
+						candidates = append(candidates, i)
+					}
+				}
+			}
+		}
+	}
+
+	matches := make([]Match, 0, len(candidates))
+	for _, i := range candidates {
+		if index.ids[i] == exclude || len(index.vectors[i]) != len(vector) {
+			continue
+		}
+		if similarity := dot(vector, index.vectors[i]); similarity > 0 {
+			matches = append(matches, Match{ImdbID: index.ids[i], Similarity: similarity})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return matches[i].ImdbID < matches[j].ImdbID
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+func (index *Index) signature(table int, vector []float32) uint32 {
+	var signature uint32
+	for b, plane := range index.planes[table] {
+		if dot(plane, vector) >= 0 {
+			signature |= 1 << b
+		}
+	}
+	return signature
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,260 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	embedBatchSize = 50
+	// indexMaxAge is how long the in-memory index is used before being reloaded,
+	// which picks up rebuilds done by other server instances.
+	indexMaxAge = 10 * time.Minute
+
+	rebuildLease    = "embeddings"
+	rebuildLeaseTTL = time.Hour
+)
+
+// ErrRebuildRunning is returned by StartRebuild while a rebuild is running.
+var ErrRebuildRunning = errors.New("embedding: a rebuild is already running")
+
+// RebuildStats describe a rebuild.
+type RebuildStats struct {
+	Movies    int // Movies in the catalogue
+	Embedded  int // Movies (re)embedded
+	Unchanged int // Movies whose vector was up to date
+	Removed   int // Vectors of deleted movies or of another model
+}
+
+var (
+	indexMu       sync.Mutex
+	cachedIndex   *Index
+	cachedModel   string
+	indexLoadedAt time.Time
+)
+
+// Rebuild embeds every movie whose text changed since its vector was computed, or
+// every movie with force, and removes vectors that are no longer needed.
+func Rebuild(ctx context.Context, embedder Embedder, force bool, client *mongo.Client) (RebuildStats, error) {
+	var stats RebuildStats
+	model := embedder.Model()
+	embeddings := database.OpenCollection("movie_embeddings", client)
+
+	// Text hashes of the vectors already computed with this model
+	known := map[string]string{}
+	cursor, err := embeddings.Find(ctx, bson.M{"model": model}, options.Find().SetProjection(bson.M{"imdb_id": 1, "text_hash": 1}))
+	if err != nil {
+		return stats, err
+	}
+	var existing []models.MovieEmbedding
+	if err := cursor.All(ctx, &existing); err != nil {
+		return stats, err
+	}
+	for _, embedding := range existing {
+		known[embedding.ImdbID] = embedding.TextHash
+	}
+
+	cursor, err = database.OpenCollection("movies", client).Find(ctx, bson.M{})
+	if err != nil {
+		return stats, err
+	}
+	var movies []models.Movie
+	if err := cursor.All(ctx, &movies); err != nil {
+		return stats, err
+	}
+	stats.Movies = len(movies)
+
+	var pending []*models.Movie
+	imdbIDs := make([]string, 0, len(movies))
+	for i := range movies {
+		imdbIDs = append(imdbIDs, movies[i].ImdbID)
+		if !force && known[movies[i].ImdbID] == textHash(MovieText(&movies[i])) {
+			stats.Unchanged++
+			continue
+		}
+		pending = append(pending, &movies[i])
+	}
+
+	for start := 0; start < len(pending); start += embedBatchSize {
+		batch := pending[start:min(start+embedBatchSize, len(pending))]
+		if _, err := embedMovies(ctx, batch, embedder, client); err != nil {
+			return stats, err
+		}
+		stats.Embedded += len(batch)
+	}
+
+	result, err := embeddings.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"imdb_id": bson.M{"$nin": imdbIDs}},
+		bson.M{"model": bson.M{"$ne": model}},
+	}})
+	if err != nil {
+		return stats, err
+	}
+	stats.Removed = int(result.DeletedCount)
+
+	invalidateIndex()
+	return stats, nil
+}
+
+// StartRebuild runs Rebuild in the background with the default embedder. A lease makes
+// sure only one rebuild runs at a time across server instances.
+func StartRebuild(force bool, client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildLeaseTTL)
+
+	acquired, err := utils.AcquireLease(rebuildLease, utils.InstanceID, rebuildLeaseTTL, client, ctx)
+	if err != nil || !acquired {
+		cancel()
+		if err == nil {
+			err = ErrRebuildRunning
+		}
+		return err
+	}
+
+	go func() {
+		defer cancel()
+		defer func() {
+			if err := utils.ReleaseLease(rebuildLease, utils.InstanceID, client, context.Background()); err != nil {
+				log.Println("Embedding rebuild: failed to release lease:", err)
+			}
+		}()
+
+		stats, err := Rebuild(ctx, Default(), force, client)
+		if err != nil {
+			log.Println("Embedding rebuild failed:", err)
+			return
+		}
+		log.Printf("Embedding rebuild: %d movies, %d embedded, %d unchanged, %d removed",
+			stats.Movies, stats.Embedded, stats.Unchanged, stats.Removed)
+	}()
+	return nil
+}
+
+// Similar returns the k movies closest to the given one. The movie's vector is computed
+// on the spot if it is missing or outdated and added to the in-memory index, so new movies
+// can be queried before a rebuild and then show up in other movies' results.
+func Similar(ctx context.Context, movie *models.Movie, k int, client *mongo.Client) ([]Match, error) {
+	embedder := Default()
+
+	vector, err := movieVector(ctx, movie, embedder, client)
+	if err != nil {
+		return nil, err
+	}
+	index, err := loadIndex(ctx, embedder.Model(), client)
+	if err != nil {
+		return nil, err
+	}
+	return index.Nearest(vector, k, movie.ImdbID), nil
+}
+
+func movieVector(ctx context.Context, movie *models.Movie, embedder Embedder, client *mongo.Client) ([]float32, error) {
+	var stored models.MovieEmbedding
+	err := database.OpenCollection("movie_embeddings", client).FindOne(ctx, bson.M{"imdb_id": movie.ImdbID}).Decode(&stored)
+	if err == nil && stored.Model == embedder.Model() && stored.TextHash == textHash(MovieText(movie)) {
+		return stored.Vector, nil
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	vectors, err := embedMovies(ctx, []*models.Movie{movie}, embedder, client)
+	if err != nil {
+		return nil, err
+	}
+	// Reloading the whole index instead would cost every miss a full read of movie_embeddings
+	addToIndex(embedder.Model(), movie.ImdbID, vectors[0])
+	return vectors[0], nil
+}
+
+// embedMovies computes and stores the vectors of a batch of movies, and returns them.
+func embedMovies(ctx context.Context, movies []*models.Movie, embedder Embedder, client *mongo.Client) ([][]float32, error) {
+	texts := make([]string, 0, len(movies))
+	for _, movie := range movies {
+		texts = append(texts, MovieText(movie))
+	}
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(movies))
+	for i, movie := range movies {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"imdb_id": movie.ImdbID}).
+			SetReplacement(models.MovieEmbedding{
+				ImdbID:    movie.ImdbID,
+				Model:     embedder.Model(),
+				Vector:    vectors[i],
+				TextHash:  textHash(texts[i]),
+				UpdatedAt: now,
+			}).
+			SetUpsert(true))
+	}
+	if _, err := database.OpenCollection("movie_embeddings", client).BulkWrite(ctx, writes); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// loadIndex returns the in-memory index of the model's vectors, loading it if needed.
+func loadIndex(ctx context.Context, model string, client *mongo.Client) (*Index, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	if cachedIndex != nil && cachedModel == model && time.Since(indexLoadedAt) < indexMaxAge {
+		return cachedIndex, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 0, "imdb_id": 1, "vector": 1})
+	cursor, err := database.OpenCollection("movie_embeddings", client).Find(ctx, bson.M{"model": model}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var embeddings []models.MovieEmbedding
+	if err := cursor.All(ctx, &embeddings); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(embeddings))
+	vectors := make([][]float32, 0, len(embeddings))
+	for _, embedding := range embeddings {
+		ids = append(ids, embedding.ImdbID)
+		vectors = append(vectors, embedding.Vector)
+	}
+
+	cachedIndex, cachedModel, indexLoadedAt = NewIndex(ids, vectors), model, time.Now()
+	return cachedIndex, nil
+}
+
+// addToIndex adds a vector to the in-memory index if it is loaded for the model. Otherwise
+// the vector is picked up when the index is loaded.
+func addToIndex(model, imdbID string, vector []float32) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if cachedIndex != nil && cachedModel == model {
+		cachedIndex.Add(imdbID, vector)
+	}
+}
+
+func invalidateIndex() {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	cachedIndex = nil
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrInvalid is returned for edits that cannot be applied.
+var ErrInvalid = errors.New("enrichment: invalid edit")
+
+// Edit applies an admin's changes to the enrichment of a movie and returns the result,
+// or mongo.ErrNoDocuments for unknown movies. Edited fields are locked unless listed in
+// req.Unlock; unlocking lets the job regenerate a field on its next forced run.
+func Edit(ctx context.Context, imdbID string, req models.EnrichmentEditRequest, adminID string, client *mongo.Client) (*models.MovieEnrichment, error) {
+	for _, field := range req.Lock {
+		if slices.Contains(req.Unlock, field) {
+			return nil, fmt.Errorf("%w: %s is both locked and unlocked", ErrInvalid, field)
+		}
+	}
+
+	movies := database.OpenCollection("movies", client)
+	var movie models.Movie
+	opts := options.FindOne().SetProjection(bson.M{"enrichment": 1})
+	if err := movies.FindOne(ctx, bson.M{"imdb_id": imdbID}, opts).Decode(&movie); err != nil {
+		return nil, err
+	}
+	existing := movie.Enrichment
+	if existing == nil {
+		existing = &models.MovieEnrichment{}
+	}
+
+	now := time.Now()
+	set := bson.M{}
+	edited := func(field string, value any) {
+		set["enrichment."+field] = bson.M{
+			"value":      value,
+			"source":     models.EnrichmentSourceAdmin,
+			"edited_by":  adminID,
+			"updated_at": now,
+			"locked":     !slices.Contains(req.Unlock, field),
+		}
+	}
+	if req.Synopsis != nil {
+		edited(models.EnrichmentSynopsis, strings.TrimSpace(*req.Synopsis))
+	}
+	if req.MoodTags != nil {
+		edited(models.EnrichmentMoodTags, NormalizeTags(*req.MoodTags))
+	}
+	if req.ContentWarnings != nil {
+		warnings, unknown := NormalizeWarnings(*req.ContentWarnings)
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("%w: unknown content warnings %s", ErrInvalid, strings.Join(unknown, ", "))
+		}
+		edited(models.EnrichmentContentWarnings, warnings)
+	}
+
+	// Fields that are not edited, with the value an admin locking a missing one stands for
+	empty := map[string]any{
+		models.EnrichmentSynopsis:        "",
+		models.EnrichmentMoodTags:        []string{},
+		models.EnrichmentContentWarnings: []string{},
+	}
+	exists := map[string]bool{
+		models.EnrichmentSynopsis:        existing.Synopsis != nil,
+		models.EnrichmentMoodTags:        existing.MoodTags != nil,
+		models.EnrichmentContentWarnings: existing.ContentWarnings != nil,
+	}
+	for _, field := range models.EnrichmentFields {
+		if _, ok := set["enrichment."+field]; ok {
+			continue
+		}
+		switch {
+		case slices.Contains(req.Lock, field) && exists[field]:
+			set["enrichment."+field+".locked"] = true
+		case slices.Contains(req.Lock, field):
+			// Locked empty, so that the job does not generate it
+			edited(field, empty[field])
+		case slices.Contains(req.Unlock, field) && exists[field]:
+			set["enrichment."+field+".locked"] = false
+		}
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("%w: nothing to change", ErrInvalid)
+	}
+
+	err := movies.FindOneAndUpdate(ctx,
+		bson.M{"imdb_id": imdbID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetProjection(bson.M{"enrichment": 1}).SetReturnDocument(options.After),
+	).Decode(&movie)
+	if err != nil {
+		return nil, err
+	}
+	return movie.Enrichment, nil
+}
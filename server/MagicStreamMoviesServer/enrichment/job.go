@@ -0,0 +1,179 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/llm"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	jobTimeout      = 6 * time.Hour
+	generateTimeout = time.Minute
+	// The job stops after this many movies failed in a row, as the model is likely unavailable
+	maxConsecutiveFailures = 10
+)
+
+// Start runs the enrichment job in the background and returns it. It fails with
+// jobs.ErrRunning while another enrichment job runs.
+func Start(req models.EnrichmentRunRequest, adminID string, client *mongo.Client) (*models.Job, error) {
+	params := bson.M{"force": req.Force}
+	if len(req.ImdbIDs) > 0 {
+		params["imdb_ids"] = req.ImdbIDs
+	}
+	return jobs.Start(models.JobTypeEnrichment, params, adminID, jobTimeout, client, func(ctx context.Context, tracker *jobs.Tracker) error {
+		llmClient, err := llm.Default(ctx)
+		if err != nil {
+			return err
+		}
+		return run(ctx, llmClient, req, tracker, client)
+	})
+}
+
+func run(ctx context.Context, llmClient llm.Client, req models.EnrichmentRunRequest, tracker *jobs.Tracker, client *mongo.Client) error {
+	movies := database.OpenCollection("movies", client)
+
+	// IDs first: generating is slow, and a cursor left open that long would time out
+	filter := bson.M{}
+	if len(req.ImdbIDs) > 0 {
+		filter["imdb_id"] = bson.M{"$in": req.ImdbIDs}
+	}
+	values, err := movies.Distinct(ctx, "imdb_id", filter).Raw()
+	if err != nil {
+		return err
+	}
+	elements, err := values.Values()
+	if err != nil {
+		return err
+	}
+	if err := tracker.SetTotal(ctx, int64(len(elements))); err != nil {
+		return err
+	}
+
+	consecutiveFailures := 0
+	for _, element := range elements {
+		imdbID, ok := element.StringValueOK()
+		if !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		generated, err := enrichMovie(ctx, llmClient, imdbID, req.Force, client)
+		switch {
+		case err != nil:
+			consecutiveFailures++
+			err = tracker.Failed(ctx, imdbID, err)
+		case generated:
+			consecutiveFailures = 0
+			err = tracker.Succeeded(ctx)
+		default:
+			err = tracker.Skipped(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if consecutiveFailures == maxConsecutiveFailures {
+			return fmt.Errorf("stopped after %d movies failed in a row", maxConsecutiveFailures)
+		}
+	}
+	return nil
+}
+
+// enrichMovie generates the fields of a movie that need it. It reports whether anything
+// was generated.
+func enrichMovie(ctx context.Context, llmClient llm.Client, imdbID string, force bool, client *mongo.Client) (bool, error) {
+	movies := database.OpenCollection("movies", client)
+
+	var movie models.Movie
+	if err := movies.FindOne(ctx, bson.M{"imdb_id": imdbID}).Decode(&movie); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil // Deleted since the job started
+		}
+		return false, err
+	}
+
+	fields := fieldsToGenerate(movie.Enrichment, llmClient.Model(), force)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	generateCtx, cancel := context.WithTimeout(ctx, generateTimeout)
+	defer cancel()
+	generated, err := Generate(generateCtx, llmClient, &movie)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	provenance := func(field string, value any) mongo.WriteModel {
+		// Locking between reading the movie and now wins over the generated value
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"imdb_id": imdbID, "enrichment." + field + ".locked": bson.M{"$ne": true}}).
+			SetUpdate(bson.M{"$set": bson.M{"enrichment." + field: bson.M{
+				"value":          value,
+				"source":         models.EnrichmentSourceLLM,
+				"model":          llmClient.Model(),
+				"prompt_version": PromptVersion,
+				"updated_at":     now,
+				"locked":         false,
+			}}})
+	}
+	var writes []mongo.WriteModel
+	for _, field := range fields {
+		switch field {
+		case models.EnrichmentSynopsis:
+			writes = append(writes, provenance(field, generated.Synopsis))
+		case models.EnrichmentMoodTags:
+			writes = append(writes, provenance(field, generated.MoodTags))
+		case models.EnrichmentContentWarnings:
+			writes = append(writes, provenance(field, generated.ContentWarnings))
+		}
+	}
+	if _, err := movies.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fieldsToGenerate returns the unlocked fields that are missing or, with force, all
+// unlocked fields. Without force, fields written by an admin or generated with the
+// current model and prompt version are kept.
+func fieldsToGenerate(enrichment *models.MovieEnrichment, model string, force bool) []string {
+	if enrichment == nil {
+		enrichment = &models.MovieEnrichment{}
+	}
+	var fields []string
+	if needsGenerating(enrichment.Synopsis, model, force) {
+		fields = append(fields, models.EnrichmentSynopsis)
+	}
+	if needsGenerating(enrichment.MoodTags, model, force) {
+		fields = append(fields, models.EnrichmentMoodTags)
+	}
+	if needsGenerating(enrichment.ContentWarnings, model, force) {
+		fields = append(fields, models.EnrichmentContentWarnings)
+	}
+	return fields
+}
+
+func needsGenerating[T any](field *models.EnrichedField[T], model string, force bool) bool {
+	switch {
+	case field == nil:
+		return true
+	case field.Locked:
+		return false
+	case force:
+		return true
+	default:
+		return field.Source == models.EnrichmentSourceLLM && (field.Model != model || field.PromptVersion != PromptVersion)
+	}
+}
@@ -0,0 +1,28 @@
+package experiments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// Assign returns the variant of the experiment a user is in. It hashes the experiment
+// and user IDs, so a user always gets the same variant of an experiment and the split
+// of one experiment does not depend on the split of another.
+func Assign(experiment *models.Experiment, userID string) models.ExperimentVariant {
+	total := 0
+	for _, variant := range experiment.Variants {
+		total += variant.Weight
+	}
+
+	sum := sha256.Sum256([]byte(experiment.ExperimentID + ":" + userID))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, variant := range experiment.Variants {
+		if bucket < variant.Weight {
+			return variant
+		}
+		bucket -= variant.Weight
+	}
+	return experiment.Variants[len(experiment.Variants)-1]
+}
@@ -0,0 +1,120 @@
+// Package experiments splits users between recommendation strategies and measures
+// how each one does.
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/recommender"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	// ErrInvalid is returned when creating an experiment with unusable variants.
+	ErrInvalid = errors.New("experiments: invalid experiment")
+	// ErrWrongStatus is returned when starting an experiment that is not a draft,
+	// or stopping one that is not running.
+	ErrWrongStatus = errors.New("experiments: wrong status")
+	// ErrAlreadyRunning is returned when starting an experiment while another one runs.
+	ErrAlreadyRunning = errors.New("experiments: another experiment is running")
+)
+
+// Create saves a new draft experiment.
+func Create(ctx context.Context, req models.ExperimentRequest, adminID string, client *mongo.Client) (*models.Experiment, error) {
+	names := make([]string, 0, len(req.Variants))
+	for _, variant := range req.Variants {
+		if slices.Contains(names, variant.Name) {
+			return nil, fmt.Errorf("%w: variant %q is listed twice", ErrInvalid, variant.Name)
+		}
+		if !slices.Contains(recommender.Strategies, variant.Strategy) {
+			return nil, fmt.Errorf("%w: unknown strategy %q", ErrInvalid, variant.Strategy)
+		}
+		names = append(names, variant.Name)
+	}
+
+	experiment := models.Experiment{
+		ExperimentID: bson.NewObjectID().Hex(),
+		Name:         req.Name,
+		Description:  req.Description,
+		Variants:     req.Variants,
+		Status:       models.ExperimentDraft,
+		CreatedBy:    adminID,
+		CreatedAt:    time.Now(),
+	}
+	if _, err := database.OpenCollection("experiments", client).InsertOne(ctx, experiment); err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// Get returns an experiment, or mongo.ErrNoDocuments.
+func Get(ctx context.Context, experimentID string, client *mongo.Client) (*models.Experiment, error) {
+	var experiment models.Experiment
+	err := database.OpenCollection("experiments", client).FindOne(ctx, bson.M{"experiment_id": experimentID}).Decode(&experiment)
+	if err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// Running returns the running experiment, or nil when there is none.
+func Running(ctx context.Context, client *mongo.Client) (*models.Experiment, error) {
+	var experiment models.Experiment
+	err := database.OpenCollection("experiments", client).FindOne(ctx, bson.M{"status": models.ExperimentRunning}).Decode(&experiment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// Start runs a draft experiment. A partial unique index on running experiments
+// makes sure only one runs at a time.
+func Start(ctx context.Context, experimentID string, client *mongo.Client) (*models.Experiment, error) {
+	experiment, err := transition(ctx, experimentID, models.ExperimentDraft, models.ExperimentRunning, "started_at", client)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAlreadyRunning
+	}
+	return experiment, err
+}
+
+// Stop ends a running experiment. Stopped experiments keep their report but cannot be restarted.
+func Stop(ctx context.Context, experimentID string, client *mongo.Client) (*models.Experiment, error) {
+	return transition(ctx, experimentID, models.ExperimentRunning, models.ExperimentStopped, "stopped_at", client)
+}
+
+func transition(ctx context.Context, experimentID, from, to, timeField string, client *mongo.Client) (*models.Experiment, error) {
+	experiments := database.OpenCollection("experiments", client)
+
+	var experiment models.Experiment
+	err := experiments.FindOneAndUpdate(ctx,
+		bson.M{"experiment_id": experimentID, "status": from},
+		bson.M{"$set": bson.M{"status": to, timeField: time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&experiment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Tell a missing experiment from one in another status
+		count, countErr := experiments.CountDocuments(ctx, bson.M{"experiment_id": experimentID})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count > 0 {
+			return nil, ErrWrongStatus
+		}
+		return nil, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
@@ -0,0 +1,62 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ClickWindow is how long after a movie was last shown a click on it is still counted.
+const ClickWindow = 24 * time.Hour
+
+// LogImpressions records the movies shown to a user in a variant of the experiment.
+func LogImpressions(ctx context.Context, experiment *models.Experiment, variant, userID string, movies []models.RecommendedMovie, client *mongo.Client) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(movies))
+	for i, movie := range movies {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"experiment_id": experiment.ExperimentID, "user_id": userID, "imdb_id": movie.ImdbID}).
+			SetUpdate(bson.M{
+				"$setOnInsert": bson.M{"variant": variant, "position": i + 1, "first_shown_at": now},
+				"$set":         bson.M{"last_shown_at": now},
+				"$inc":         bson.M{"shown_count": 1},
+			}).
+			SetUpsert(true))
+	}
+	_, err := database.OpenCollection("recommendation_impressions", client).BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// RecordClick marks the latest impression of the movie for the user as clicked, if the
+// movie was shown within ClickWindow. It reports whether a click was recorded; clicking
+// the same impression twice only counts once.
+func RecordClick(ctx context.Context, userID, imdbID string, client *mongo.Client) (bool, error) {
+	now := time.Now()
+	err := database.OpenCollection("recommendation_impressions", client).FindOneAndUpdate(ctx,
+		bson.M{
+			"user_id":       userID,
+			"imdb_id":       imdbID,
+			"last_shown_at": bson.M{"$gte": now.Add(-ClickWindow)},
+			"clicked_at":    bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"clicked_at": now}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "last_shown_at", Value: -1}}),
+	).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
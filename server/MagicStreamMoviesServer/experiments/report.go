@@ -0,0 +1,186 @@
+package experiments
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WatchWindow is how long after a movie was first shown finishing it counts as watched through.
+const WatchWindow = 7 * 24 * time.Hour
+
+// z is the normal quantile of the 95% confidence intervals.
+const z = 1.96
+
+// Report computes the results of each variant of the experiment:
+//   - CTR: share of impressions that were clicked
+//   - Watch-through: share of impressions whose movie the user finished within WatchWindow
+//
+// A user's impressions are not independent (some users click much more than others), so
+// the intervals treat users as the sampled units; see ClusteredRate.
+func Report(ctx context.Context, experiment *models.Experiment, client *mongo.Client) (*models.ExperimentReport, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"experiment_id": experiment.ExperimentID}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "watch_events",
+			"let":  bson.M{"user_id": "$user_id", "imdb_id": "$imdb_id", "shown_at": "$first_shown_at"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$user_id", "$$user_id"}},
+					bson.M{"$eq": bson.A{"$imdb_id", "$$imdb_id"}},
+					bson.M{"$eq": bson.A{"$finished", true}},
+					bson.M{"$gte": bson.A{"$finished_at", "$$shown_at"}},
+					bson.M{"$lte": bson.A{"$finished_at", bson.M{"$add": bson.A{"$$shown_at", WatchWindow.Milliseconds()}}}},
+				}}}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "watched",
+		}}},
+		// Per user first, so that users are counted without collecting them all
+		{{Key: "$group", Value: bson.M{
+			"_id":         bson.M{"variant": "$variant", "user_id": "$user_id"},
+			"impressions": bson.M{"$sum": 1},
+			"clicks":      bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$clicked_at", false}}, 1, 0}}},
+			"watched":     bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{bson.M{"$size": "$watched"}, 0}}, 1, 0}}},
+		}}},
+		// The sums of squares and products give the variance between users
+		{{Key: "$group", Value: bson.M{
+			"_id":                 "$_id.variant",
+			"users":               bson.M{"$sum": 1},
+			"impressions":         bson.M{"$sum": "$impressions"},
+			"clicks":              bson.M{"$sum": "$clicks"},
+			"watched":             bson.M{"$sum": "$watched"},
+			"impressions_sq":      bson.M{"$sum": bson.M{"$multiply": bson.A{"$impressions", "$impressions"}}},
+			"clicks_sq":           bson.M{"$sum": bson.M{"$multiply": bson.A{"$clicks", "$clicks"}}},
+			"watched_sq":          bson.M{"$sum": bson.M{"$multiply": bson.A{"$watched", "$watched"}}},
+			"clicks_impressions":  bson.M{"$sum": bson.M{"$multiply": bson.A{"$clicks", "$impressions"}}},
+			"watched_impressions": bson.M{"$sum": bson.M{"$multiply": bson.A{"$watched", "$impressions"}}},
+		}}},
+	}
+
+	cursor, err := database.OpenCollection("recommendation_impressions", client).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	var results []struct {
+		Variant            string  `bson:"_id"`
+		Users              int64   `bson:"users"`
+		Impressions        int64   `bson:"impressions"`
+		Clicks             int64   `bson:"clicks"`
+		Watched            int64   `bson:"watched"`
+		ImpressionsSq      float64 `bson:"impressions_sq"`
+		ClicksSq           float64 `bson:"clicks_sq"`
+		WatchedSq          float64 `bson:"watched_sq"`
+		ClicksImpressions  float64 `bson:"clicks_impressions"`
+		WatchedImpressions float64 `bson:"watched_impressions"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	report := &models.ExperimentReport{
+		ExperimentID: experiment.ExperimentID,
+		Name:         experiment.Name,
+		Status:       experiment.Status,
+		Variants:     make([]models.VariantReport, 0, len(experiment.Variants)),
+		GeneratedAt:  time.Now(),
+	}
+	// In the order of the experiment, including variants nobody saw yet
+	for _, variant := range experiment.Variants {
+		variantReport := models.VariantReport{Variant: variant.Name, Strategy: variant.Strategy}
+		clicks := ClusterSums{}
+		watched := ClusterSums{}
+		for _, result := range results {
+			if result.Variant == variant.Name {
+				variantReport.Users = result.Users
+				variantReport.Impressions = result.Impressions
+				variantReport.Clicks = result.Clicks
+				variantReport.Watched = result.Watched
+				clicks = ClusterSums{
+					Clusters: result.Users, Successes: result.Clicks, Trials: result.Impressions,
+					SuccessesSq: result.ClicksSq, TrialsSq: result.ImpressionsSq, Cross: result.ClicksImpressions,
+				}
+				watched = ClusterSums{
+					Clusters: result.Users, Successes: result.Watched, Trials: result.Impressions,
+					SuccessesSq: result.WatchedSq, TrialsSq: result.ImpressionsSq, Cross: result.WatchedImpressions,
+				}
+			}
+		}
+		variantReport.CTR = ClusteredRate(clicks)
+		variantReport.WatchThrough = ClusteredRate(watched)
+		report.Variants = append(report.Variants, variantReport)
+	}
+	return report, nil
+}
+
+// ClusterSums summarizes successes and trials observed in clusters (users): the totals,
+// and over the clusters the sums of successes², trials² and successes × trials.
+type ClusterSums struct {
+	Clusters    int64
+	Successes   int64
+	Trials      int64
+	SuccessesSq float64
+	TrialsSq    float64
+	Cross       float64
+}
+
+// ClusteredRate returns the proportion of successes with a 95% interval that accounts for
+// trials of the same cluster being correlated. The variance of the proportion, a ratio of
+// cluster totals, comes from the delta method with clusters as the independent units:
+//
+//	Var(p) = Σ(sᵢ - p·tᵢ)² / (k(k-1)·t̄²)
+//
+// It is turned into the number of independent trials it is worth, p(1-p)/Var(p), at most
+// the actual number of trials, and the interval is the Wilson interval for that many trials.
+// A proportion of 0 or 1 has no variance between clusters; it then counts one trial per cluster.
+func ClusteredRate(sums ClusterSums) models.ConfidenceRate {
+	// One user says nothing about the variance between users
+	if sums.Trials <= 0 || sums.Clusters < 2 {
+		rate := models.ConfidenceRate{Low: 0, High: 1}
+		if sums.Trials > 0 {
+			rate.Value = float64(sums.Successes) / float64(sums.Trials)
+		}
+		return rate
+	}
+
+	k := float64(sums.Clusters)
+	n := float64(sums.Trials)
+	p := float64(sums.Successes) / n
+	meanTrials := n / k
+	// Σ(sᵢ - p·tᵢ)², expanded so that it only needs the sums
+	residuals := math.Max(0, sums.SuccessesSq-2*p*sums.Cross+p*p*sums.TrialsSq)
+	variance := residuals / (k * (k - 1) * meanTrials * meanTrials)
+
+	effective := k
+	if variance > 0 {
+		effective = math.Min(n, p*(1-p)/variance)
+	}
+	return wilson(p, effective)
+}
+
+// wilson is the 95% Wilson score interval of proportion p observed over n trials, which
+// unlike the normal approximation stays within [0, 1] and works for small counts.
+func wilson(p, n float64) models.ConfidenceRate {
+	denominator := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denominator
+	margin := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denominator
+	return models.ConfidenceRate{
+		Value: p,
+		Low:   math.Max(0, center-margin),
+		High:  math.Min(1, center+margin),
+	}
+}
@@ -0,0 +1,77 @@
+package experiments
+
+import (
+	"math"
+	"testing"
+)
+
+// sums adds up users given as {successes, trials} pairs.
+func sums(users ...[2]int64) ClusterSums {
+	var s ClusterSums
+	for _, user := range users {
+		successes, trials := float64(user[0]), float64(user[1])
+		s.Clusters++
+		s.Successes += user[0]
+		s.Trials += user[1]
+		s.SuccessesSq += successes * successes
+		s.TrialsSq += trials * trials
+		s.Cross += successes * trials
+	}
+	return s
+}
+
+func repeat(user [2]int64, times int) [][2]int64 {
+	users := make([][2]int64, times)
+	for i := range users {
+		users[i] = user
+	}
+	return users
+}
+
+func TestClusteredRateWidensForCorrelatedUsers(t *testing.T) {
+	// Half the users click everything they see, the other half nothing: 1000 impressions,
+	// but only 100 independent answers
+	users := append(repeat([2]int64{10, 10}, 50), repeat([2]int64{0, 10}, 50)...)
+	rate := ClusteredRate(sums(users...))
+	perUser := wilson(0.5, 100)
+	perImpression := wilson(0.5, 1000)
+
+	if rate.Value != 0.5 {
+		t.Errorf("Value = %v, want 0.5", rate.Value)
+	}
+	if math.Abs(rate.Low-perUser.Low) > 0.005 || math.Abs(rate.High-perUser.High) > 0.005 {
+		t.Errorf("interval [%v, %v], want about the per-user one [%v, %v]", rate.Low, rate.High, perUser.Low, perUser.High)
+	}
+	if rate.High-rate.Low < 2*(perImpression.High-perImpression.Low) {
+		t.Errorf("interval [%v, %v] should be much wider than the per-impression one [%v, %v]", rate.Low, rate.High, perImpression.Low, perImpression.High)
+	}
+}
+
+func TestClusteredRateMatchesWilsonForIndependentTrials(t *testing.T) {
+	// One impression per user: users and impressions are the same thing
+	users := append(repeat([2]int64{1, 1}, 30), repeat([2]int64{0, 1}, 270)...)
+	rate := ClusteredRate(sums(users...))
+	want := wilson(0.1, 300)
+
+	if math.Abs(rate.Low-want.Low) > 0.002 || math.Abs(rate.High-want.High) > 0.002 {
+		t.Errorf("interval [%v, %v], want about [%v, %v]", rate.Low, rate.High, want.Low, want.High)
+	}
+}
+
+func TestClusteredRateEdgeCases(t *testing.T) {
+	if rate := ClusteredRate(ClusterSums{}); rate.Low != 0 || rate.High != 1 {
+		t.Errorf("no impressions: %+v", rate)
+	}
+	if rate := ClusteredRate(sums([2]int64{3, 10})); rate.Value != 0.3 || rate.Low != 0 || rate.High != 1 {
+		t.Errorf("one user: %+v", rate)
+	}
+
+	// Nobody clicked: no variance between users, so each user counts once
+	rate := ClusteredRate(sums(repeat([2]int64{0, 20}, 40)...))
+	if want := wilson(0, 40); rate.Value != 0 || rate.High != want.High {
+		t.Errorf("no clicks: %+v, want high %v", rate, want.High)
+	}
+	if rate.Low < 0 || rate.High > 1 {
+		t.Errorf("interval out of [0, 1]: %+v", rate)
+	}
+}
@@ -0,0 +1,153 @@
+// Package jobs runs admin-triggered background jobs and tracks their progress in the
+// jobs collection, so that admins can follow them and read their error reports.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrRunning is returned when starting a job while another job of the same type runs.
+var ErrRunning = errors.New("jobs: a job of this type is already running")
+
+// Func does the work of a job, reporting progress through the tracker. Returning an
+// error fails the job.
+type Func func(ctx context.Context, tracker *Tracker) error
+
+// Start records a job and runs it in the background for at most timeout. A lease named
+// after the job type makes sure one job of each type runs at a time across server instances.
+func Start(jobType string, params bson.M, createdBy string, timeout time.Duration, client *mongo.Client, run Func) (*models.Job, error) {
+	return StartFor(jobType, "", params, createdBy, timeout, client, run)
+}
+
+// StartFor is Start for jobs that run once per key, such as one erasure per user: jobs of
+// the same type run side by side as long as their keys differ.
+func StartFor(jobType, key string, params bson.M, createdBy string, timeout time.Duration, client *mongo.Client, run Func) (*models.Job, error) {
+	job, execute, err := begin(jobType, key, params, createdBy, timeout, client)
+	if err != nil {
+		return nil, err
+	}
+	go execute(run)
+	return job, nil
+}
+
+// Run is Start for callers that wait, such as command line tools. It returns the job as
+// it finished.
+func Run(jobType string, params bson.M, createdBy string, timeout time.Duration, client *mongo.Client, run Func) (*models.Job, error) {
+	job, execute, err := begin(jobType, "", params, createdBy, timeout, client)
+	if err != nil {
+		return nil, err
+	}
+	execute(run)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	return Get(ctx, job.JobID, client)
+}
+
+// begin takes the lease and records the job. The returned function runs it, records how
+// it ended and releases the lease.
+func begin(jobType, key string, params bson.M, createdBy string, timeout time.Duration, client *mongo.Client) (*models.Job, func(Func), error) {
+	lease := "job:" + jobType
+	interrupted := bson.M{"type": jobType, "status": models.JobRunning}
+	if key != "" {
+		lease += ":" + key
+		interrupted["key"] = key
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	acquired, err := utils.AcquireLease(lease, utils.InstanceID, timeout, client, ctx)
+	if err != nil || !acquired {
+		cancel()
+		if err == nil {
+			err = ErrRunning
+		}
+		return nil, nil, err
+	}
+
+	collection := database.OpenCollection("jobs", client)
+	now := time.Now()
+	// Holding the lease means no job of this type (and key) runs: any still marked as
+	// running was interrupted by a server stop
+	_, err = collection.UpdateMany(ctx,
+		interrupted,
+		bson.M{"$set": bson.M{"status": models.JobFailed, "error": "interrupted", "finished_at": now}},
+	)
+	if err == nil {
+		job := models.Job{
+			JobID:     bson.NewObjectID().Hex(),
+			Type:      jobType,
+			Key:       key,
+			Status:    models.JobRunning,
+			Params:    params,
+			CreatedBy: createdBy,
+			StartedAt: now,
+			UpdatedAt: now,
+		}
+		if _, err = collection.InsertOne(ctx, job); err == nil {
+			return &job, func(run Func) { execute(ctx, cancel, &job, lease, run, client) }, nil
+		}
+	}
+
+	cancel()
+	if releaseErr := utils.ReleaseLease(lease, utils.InstanceID, client, context.Background()); releaseErr != nil {
+		log.Printf("Job %s: failed to release lease: %v", jobType, releaseErr)
+	}
+	return nil, nil, err
+}
+
+func execute(ctx context.Context, cancel context.CancelFunc, job *models.Job, lease string, run Func, client *mongo.Client) {
+	defer cancel()
+	defer func() {
+		if err := utils.ReleaseLease(lease, utils.InstanceID, client, context.Background()); err != nil {
+			log.Printf("Job %s: failed to release lease: %v", job.JobID, err)
+		}
+	}()
+
+	tracker := &Tracker{jobID: job.JobID, client: client}
+	runErr := runRecovered(ctx, tracker, run)
+
+	set := bson.M{"status": models.JobSucceeded, "finished_at": time.Now(), "updated_at": time.Now()}
+	if runErr != nil {
+		log.Printf("Job %s (%s) failed: %v", job.JobID, job.Type, runErr)
+		set["status"] = models.JobFailed
+		set["error"] = runErr.Error()
+	}
+	// The job's context may be over, but its outcome must still be recorded
+	finishCtx, finishCancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer finishCancel()
+	if _, err := database.OpenCollection("jobs", client).UpdateOne(finishCtx, bson.M{"job_id": job.JobID}, bson.M{"$set": set}); err != nil {
+		log.Printf("Job %s: failed to record outcome: %v", job.JobID, err)
+	}
+}
+
+// runRecovered runs a job, turning a panic into an error: a panicking job must neither
+// take the server down nor stay running.
+func runRecovered(ctx context.Context, tracker *Tracker, run Func) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Job %s panicked: %v\n%s", tracker.jobID, recovered, debug.Stack())
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return run(ctx, tracker)
+}
+
+// Get returns a job, or mongo.ErrNoDocuments.
+func Get(ctx context.Context, jobID string, client *mongo.Client) (*models.Job, error) {
+	var job models.Job
+	if err := database.OpenCollection("jobs", client).FindOne(ctx, bson.M{"job_id": jobID}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
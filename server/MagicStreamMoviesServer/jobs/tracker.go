@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Tracker records the progress of a running job.
+type Tracker struct {
+	jobID  string
+	client *mongo.Client
+}
+
+// JobID is the ID of the tracked job.
+func (t *Tracker) JobID() string {
+	return t.jobID
+}
+
+// SetTotal records how many items the job will process.
+func (t *Tracker) SetTotal(ctx context.Context, total int64) error {
+	return t.update(ctx, bson.M{"$set": bson.M{"progress.total": total}})
+}
+
+// Succeeded counts an item processed successfully.
+func (t *Tracker) Succeeded(ctx context.Context) error {
+	return t.update(ctx, bson.M{"$inc": bson.M{"progress.processed": 1, "progress.succeeded": 1}})
+}
+
+// Skipped counts an item that needed nothing done.
+func (t *Tracker) Skipped(ctx context.Context) error {
+	return t.update(ctx, bson.M{"$inc": bson.M{"progress.processed": 1, "progress.skipped": 1}})
+}
+
+// Failed counts an item that could not be processed, and adds it to the error report
+// while it holds fewer than models.MaxJobErrors errors.
+func (t *Tracker) Failed(ctx context.Context, item string, err error) error {
+	return t.update(ctx, bson.M{
+		"$inc": bson.M{"progress.processed": 1, "progress.failed": 1},
+		"$push": bson.M{"errors": bson.M{
+			"$each":  bson.A{models.JobError{Item: item, Message: err.Error()}},
+			"$slice": models.MaxJobErrors,
+		}},
+	})
+}
+
+// Record counts a batch of items at once: those that succeeded, were skipped or failed
+// with the given errors.
+func (t *Tracker) Record(ctx context.Context, succeeded, skipped int64, failures []models.JobError) error {
+	update := bson.M{"$inc": bson.M{
+		"progress.processed": succeeded + skipped + int64(len(failures)),
+		"progress.succeeded": succeeded,
+		"progress.skipped":   skipped,
+		"progress.failed":    len(failures),
+	}}
+	if len(failures) > 0 {
+		update["$push"] = bson.M{"errors": bson.M{"$each": failures, "$slice": models.MaxJobErrors}}
+	}
+	return t.update(ctx, update)
+}
+
+// SetResult records a summary of what the job did.
+func (t *Tracker) SetResult(ctx context.Context, result any) error {
+	return t.update(ctx, bson.M{"$set": bson.M{"result": result}})
+}
+
+func (t *Tracker) update(ctx context.Context, update bson.M) error {
+	if set, ok := update["$set"].(bson.M); ok {
+		set["updated_at"] = time.Now()
+	} else {
+		update["$set"] = bson.M{"updated_at": time.Now()}
+	}
+	_, err := database.OpenCollection("jobs", t.client).UpdateOne(ctx, bson.M{"job_id": t.jobID}, update)
+	return err
+}
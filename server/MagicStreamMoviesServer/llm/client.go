@@ -0,0 +1,96 @@
+// Package llm is the interface to the language model used for review rankings,
+// moderation and other text tasks. Callers depend on Client, so tests and offline
+// setups can swap Gemini for something else.
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// DefaultModel is the Gemini model used when GEMINI_MODEL is not set.
+const DefaultModel = "gemini-2.5-flash"
+
+// Client generates a text answer to a prompt.
+type Client interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+	// Model names the model answering, for provenance.
+	Model() string
+}
+
+// Gemini is a Client backed by the Gemini API.
+type Gemini struct {
+	client *genai.Client
+	model  string
+}
+
+// NewGemini connects to Gemini. The API key is read from GEMINI_API_KEY by the SDK.
+func NewGemini(ctx context.Context) (*Gemini, error) {
+	client, err := genai.NewClient(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	model := os.Getenv("GEMINI_MODEL")
+	if model == "" {
+		model = DefaultModel
+	}
+	return &Gemini{client: client, model: model}, nil
+}
+
+func (g *Gemini) Model() string {
+	return g.model
+}
+
+// Generate sends the prompt and returns the answer without surrounding whitespace.
+func (g *Gemini) Generate(ctx context.Context, prompt string) (string, error) {
+	response, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(prompt), nil)
+	if err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(response.Text())
+	if text == "" {
+		return "", errors.New("llm: empty answer")
+	}
+	return text, nil
+}
+
+// StripCodeFence removes the ```json fence models like to wrap JSON answers in.
+func StripCodeFence(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if !strings.HasPrefix(answer, "```") {
+		return answer
+	}
+	answer = strings.TrimPrefix(answer, "```")
+	answer = strings.TrimPrefix(answer, "json")
+	answer = strings.TrimSuffix(answer, "```")
+	return strings.TrimSpace(answer)
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultClient Client
+)
+
+// Default returns a shared Gemini client. Unlike sync.Once, a failed connection is
+// retried on the next call.
+func Default(ctx context.Context) (Client, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultClient != nil {
+		return defaultClient, nil
+	}
+	client, err := NewGemini(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultClient = client
+	return defaultClient, nil
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends transactional emails (password resets, verification links, ...).
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var defaultMailer = sync.OnceValue(FromEnv)
+
+// Default returns the mailer configured by the environment, created on first use.
+func Default() Mailer {
+	return defaultMailer()
+}
+
+// FromEnv builds a mailer from the MAILER environment variable:
+//   - "smtp": SMTPMailer configured by SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM
+//   - "log" (default): LogMailer, writing to MAILER_LOG_FILE if set, otherwise to the server log
+func FromEnv() Mailer {
+	switch strings.ToLower(os.Getenv("MAILER")) {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "", "log":
+		return &LogMailer{Path: os.Getenv("MAILER_LOG_FILE")}
+	default:
+		log.Printf("Warning: unknown MAILER %q, falling back to log mailer", os.Getenv("MAILER"))
+		return &LogMailer{Path: os.Getenv("MAILER_LOG_FILE")}
+	}
+}
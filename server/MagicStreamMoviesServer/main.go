@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/eichiarakaki/magic-stream/controllers"
 	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/embedding"
+	"github.com/eichiarakaki/magic-stream/migrations"
+	"github.com/eichiarakaki/magic-stream/recommender"
 	"github.com/eichiarakaki/magic-stream/routes"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -38,12 +43,24 @@ func main() {
 		log.Println("Allowed Origin: https://localhost:5173")
 	}
 
+	// Only trust X-Forwarded-For from the listed proxies; otherwise any client could pick
+	// the IP that login throttling and logs see. Without TRUSTED_PROXIES the socket address is used.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	config := cors.Config{}
 	config.AllowOrigins = origins
 	config.AllowMethods = []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"}
 	//config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
-	config.ExposeHeaders = []string{"Content-Length"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token"}
+	config.ExposeHeaders = []string{"Content-Length", "X-CSRF-Token"}
 	config.AllowCredentials = true
 	config.MaxAge = 12 * time.Hour
 
@@ -63,8 +80,25 @@ func main() {
 
 	}()
 
+	if err := database.EnsureIndexes(client); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	if err := migrations.Run(client); err != nil {
+		log.Fatalf("Failed to migrate documents: %v", err)
+	}
+	if err := controllers.BootstrapAdmin(client); err != nil {
+		log.Fatalf("Failed to bootstrap the first admin: %v", err)
+	}
+
+	recommender.Start(context.Background(), client)
+	// Only movies added or changed since the last run are embedded
+	if err := embedding.StartRebuild(false, client); err != nil && !errors.Is(err, embedding.ErrRebuildRunning) {
+		log.Println("Failed to start embedding rebuild:", err)
+	}
+
 	routes.SetupUnProtectedRoutes(router, client)
 	routes.SetupProtectedRoutes(router, client)
+	routes.SetupAdminRoutes(router, client)
 
 	certFile := "../../localhost.pem"
 	keyFile := "../../localhost-key.pem"
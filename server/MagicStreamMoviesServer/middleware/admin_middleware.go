@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly restricts a route (or group) to the ADMIN role. It must run after AuthMiddleware.
+//
+// With REQUIRE_ADMIN_MFA enabled, admin sessions must also have been opened with a
+// second factor, and API keys created from such a session. The role of a key comes from
+// its owner at request time, so a key created before its owner was promoted, or before
+// MFA was required, does not pass.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := utils.GetUserRoleFromContext(c)
+		if err != nil || role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+			c.Abort()
+			return
+		}
+		if utils.IsAdminMFARequired() && !utils.GetMFAFromContext(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "Two-factor authentication is required for admin actions",
+				"mfa_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -5,12 +5,34 @@ import (
 
 	"github.com/eichiarakaki/magic-stream/utils"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-// AuthMiddleware validates the JWT signature/expiry
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates the JWT signature/expiry (from the Authorization header or the access_token cookie),
+// or the API key sent in the X-API-Key header
+func AuthMiddleware(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := utils.GetAccessToken(c)
+		if rawKey := c.GetHeader("X-API-Key"); rawKey != "" {
+			apiKey, owner, err := utils.AuthenticateAPIKey(rawKey, client, c)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+
+			// The role always comes from the owner so that demoting a user also restricts their keys
+			c.Set("user_id", owner.UserID)
+			c.Set("role", owner.Role)
+			c.Set("auth_method", "api_key")
+			c.Set("mfa", apiKey.MFA)
+			c.Set("email_verified", owner.EmailVerified)
+			c.Set("api_key_id", apiKey.KeyID)
+			c.Set("api_key_scopes", apiKey.Scopes)
+			c.Next()
+			return
+		}
+
+		token, authMethod, err := utils.GetAccessToken(c)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -30,9 +52,56 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// The token must belong to an open session of the user (ended on logout, password reset and force-logout)
+		user, err := utils.GetSessionUser(claims.UserID, client, c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			c.Abort()
+			return
+		}
+		if user != nil && user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+		if !utils.IsActiveSession(token, claims, user) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			c.Abort()
+			return
+		}
+
 		// 5) Put relevant info into context and continue
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("auth_method", authMethod)
+		c.Set("mfa", claims.MFA)
+		c.Set("session_id", claims.SessionID)
+		c.Set("email_verified", user.EmailVerified)
+		c.Next()
+	}
+}
+
+// RequireScope restricts an endpoint to API keys that were granted the given scope.
+// Cookie sessions are not scoped and always pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.GetAuthMethodFromContext(c) == "api_key" && !utils.HasScope(utils.GetAPIKeyScopesFromContext(c), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly rejects API key callers, e.g. so that a key cannot be used to mint more keys.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.GetAuthMethodFromContext(c) == "api_key" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to API keys"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
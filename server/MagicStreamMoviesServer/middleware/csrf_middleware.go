@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CSRFMiddleware enforces the double-submit CSRF token on mutating requests made
+// with cookie sessions. It must run after AuthMiddleware.
+//
+// Bearer and API key callers are exempt: browsers never attach those credentials
+// automatically, so a cross-site request cannot carry them.
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		if utils.GetAuthMethodFromContext(c) != "cookie" {
+			c.Next()
+			return
+		}
+
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not logged in"})
+			c.Abort()
+			return
+		}
+
+		cookieToken, _ := utils.GetCookiePolicy().Cookie(c, utils.CSRFCookieName)
+		headerToken := c.GetHeader(utils.CSRFHeaderName)
+		if !utils.ValidateCSRFToken(headerToken, cookieToken, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing CSRF token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
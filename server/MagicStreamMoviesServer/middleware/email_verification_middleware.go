@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/eichiarakaki/magic-stream/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// unverifiedAllowedRoutes can always be called by unverified accounts, whatever the policy.
+// Keys are "<method> <route>".
+var unverifiedAllowedRoutes = map[string]bool{
+	"POST /logout": true,
+	"DELETE /me":   true, // Deleting the account must never depend on verifying it first
+}
+
+// EmailVerificationMiddleware applies UNVERIFIED_ACCOUNT_POLICY=read_only: accounts whose email
+// is not verified yet can read but not create or change anything. It must run after AuthMiddleware.
+func EmailVerificationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		if utils.GetUnverifiedAccountPolicy() != utils.UnverifiedReadOnly || unverifiedAllowedRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		if verified, _ := c.Get("email_verified"); verified != true {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
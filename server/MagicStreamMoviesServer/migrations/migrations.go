@@ -0,0 +1,123 @@
+// Package migrations brings stored documents up to the schema versions the code expects.
+// Documents carry a schema_version; those without one are at version 1.
+package migrations
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	lease    = "migrations"
+	leaseTTL = 30 * time.Minute
+)
+
+// Migration moves the documents of a collection below Version to Version with an
+// update pipeline. Pipelines must be safe to run again on migrated documents.
+type Migration struct {
+	Collection  string
+	Version     int
+	Description string
+	// Apply, when set, runs before the pipeline on the documents matching filter, for
+	// changes that cannot be made by a single update. It returns how many it changed.
+	Apply    func(ctx context.Context, collection *mongo.Collection, filter bson.M) (int64, error)
+	Pipeline mongo.Pipeline
+}
+
+// All lists the migrations in the order they run. New ones are added at the end.
+var All = []Migration{
+	{
+		Collection:  "movies",
+		Version:     2,
+		Description: "extended metadata: empty cast, directors and languages",
+		Pipeline: mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"cast":      bson.M{"$ifNull": bson.A{"$cast", bson.A{}}},
+				"directors": bson.M{"$ifNull": bson.A{"$directors", bson.A{}}},
+				"languages": bson.M{"$ifNull": bson.A{"$languages", bson.A{}}},
+			}}},
+		},
+	},
+	{
+		Collection:  "users",
+		Version:     2,
+		Description: "normalized emails; accounts created before email verification count as verified",
+		Apply:       normalizeUserEmails,
+		Pipeline: mongo.Pipeline{
+			// Accounts from before email verification have no email_verified field at all
+			{{Key: "$set", Value: bson.M{
+				"email_verified": bson.M{"$ifNull": bson.A{"$email_verified", true}},
+				"email_verified_at": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$type": "$email_verified"}, "missing"}},
+					"$created_at",
+					bson.M{"$ifNull": bson.A{"$email_verified_at", "$$REMOVE"}},
+				}},
+			}}},
+		},
+	},
+	{
+		Collection:  "users",
+		Version:     3,
+		Description: "one session per device: the single stored token and refresh token are dropped, their users log in again",
+		Pipeline: mongo.Pipeline{
+			{{Key: "$unset", Value: bson.A{"token", "refresh_token"}}},
+		},
+	},
+	{
+		Collection:  "movies",
+		Version:     3,
+		Description: "language tags in their canonical form",
+		Apply:       canonicalizeMovieLanguages,
+	},
+}
+
+// Run applies the migrations to the documents that need them. A lease makes sure one
+// server instance migrates at a time; the others go on without waiting, as migrated and
+// unmigrated documents can both be read.
+func Run(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTTL)
+	defer cancel()
+
+	acquired, err := utils.AcquireLease(lease, utils.InstanceID, leaseTTL, client, ctx)
+	if err != nil || !acquired {
+		return err
+	}
+	defer func() {
+		if err := utils.ReleaseLease(lease, utils.InstanceID, client, context.Background()); err != nil {
+			log.Println("Migrations: failed to release lease:", err)
+		}
+	}()
+
+	for _, migration := range All {
+		filter := bson.M{"$or": bson.A{
+			bson.M{"schema_version": bson.M{"$exists": false}},
+			bson.M{"schema_version": bson.M{"$lt": migration.Version}},
+		}}
+		collection := database.OpenCollection(migration.Collection, client)
+
+		var applied int64
+		if migration.Apply != nil {
+			if applied, err = migration.Apply(ctx, collection, filter); err != nil {
+				return err
+			}
+		}
+
+		pipeline := append(mongo.Pipeline{}, migration.Pipeline...)
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: bson.M{"schema_version": migration.Version}}})
+
+		result, err := collection.UpdateMany(ctx, filter, pipeline)
+		if err != nil {
+			return err
+		}
+		if modified := max(applied, result.ModifiedCount); modified > 0 {
+			log.Printf("Migrated %d %s to version %d (%s)", modified, migration.Collection, migration.Version, migration.Description)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// canonicalizeMovieLanguages stores language tags the way utils.NormalizeMovie writes
+// them, as filters look them up in their canonical form.
+func canonicalizeMovieLanguages(ctx context.Context, movies *mongo.Collection, filter bson.M) (int64, error) {
+	withLanguages := bson.M{"$and": bson.A{filter, bson.M{"languages.0": bson.M{"$exists": true}}}}
+	cursor, err := movies.Find(ctx, withLanguages, options.Find().SetProjection(bson.M{"imdb_id": 1, "languages": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	var changed int64
+	for cursor.Next(ctx) {
+		var movie models.Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return changed, err
+		}
+		languages := slices.Clone(movie.Languages)
+		utils.NormalizeMovie(&movie)
+		if slices.Equal(languages, movie.Languages) {
+			continue
+		}
+		update := bson.M{"$set": bson.M{"languages": movie.Languages}}
+		if _, err := movies.UpdateOne(ctx, bson.M{"imdb_id": movie.ImdbID}, update); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, cursor.Err()
+}
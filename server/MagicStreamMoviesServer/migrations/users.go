@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// normalizeUserEmails stores emails the way utils.NormalizeEmail writes them, as logins
+// look them up normalized. Emails are updated one by one: when two accounts only differ
+// by the case of their email, the second cannot take the normalized one, and is logged
+// for an admin to resolve instead of failing the migration.
+func normalizeUserEmails(ctx context.Context, users *mongo.Collection, filter bson.M) (int64, error) {
+	notNormalized := bson.M{"$and": bson.A{filter, bson.M{"$expr": bson.M{
+		"$ne": bson.A{"$email", bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}},
+	}}}}
+	cursor, err := users.Find(ctx, notNormalized, options.Find().SetProjection(bson.M{"user_id": 1, "email": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	var changed int64
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return changed, err
+		}
+		email := utils.NormalizeEmail(user.Email)
+		_, err := users.UpdateOne(ctx, bson.M{"user_id": user.UserID}, bson.M{"$set": bson.M{"email": email}})
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("Migrations: cannot normalize the email of user %s, another account uses %s; change one of them", user.UserID, email)
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, cursor.Err()
+}
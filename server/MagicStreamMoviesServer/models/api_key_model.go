@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Scopes that can be granted to an API key. Cookie sessions are not scoped
+// and can reach every endpoint their role allows.
+const (
+	ScopeMoviesRead          = "movies:read"
+	ScopeMoviesWrite         = "movies:write"
+	ScopeReviewsWrite        = "reviews:write"
+	ScopeRecommendationsRead = "recommendations:read"
+)
+
+// APIKey is a long-lived credential used by scripts and service accounts.
+// Only the SHA-256 hash of the key is stored; the plain key is shown once at creation.
+type APIKey struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	KeyID      string        `bson:"key_id" json:"key_id"`
+	UserID     string        `bson:"user_id" json:"user_id"`
+	CreatedBy  string        `bson:"created_by" json:"created_by"`
+	Name       string        `bson:"name" json:"name"`
+	Prefix     string        `bson:"prefix" json:"prefix"` // First characters of the key, to help users recognise it
+	KeyHash    string        `bson:"key_hash" json:"-"`
+	Scopes     []string      `bson:"scopes" json:"scopes"`
+	MFA        bool          `bson:"mfa" json:"mfa"` // Created from a session opened with a second factor
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time     `bson:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time    `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,min=2,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=movies:read movies:write reviews:write recommendations:read"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+	UserID        string   `json:"user_id"` // Admins only: create the key on behalf of another (service) account
+}
+
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"` // Plain key, only returned once
+}
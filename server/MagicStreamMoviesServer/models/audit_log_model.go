@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Audit actions
+const (
+	AuditActionRoleChange  = "user.role_change"
+	AuditActionUnlock      = "user.unlock"
+	AuditActionOIDCLink    = "user.oidc_link"
+	AuditActionDelete      = "user.delete"
+	AuditActionDisable     = "user.disable"
+	AuditActionEnable      = "user.enable"
+	AuditActionForceLogout = "user.force_logout"
+	AuditActionErase       = "user.erase"
+	AuditActionExport      = "user.export"
+
+	AuditActionModerationApprove = "moderation.approve"
+	AuditActionModerationReject  = "moderation.reject"
+
+	AuditActionExperimentStart = "experiment.start"
+	AuditActionExperimentStop  = "experiment.stop"
+)
+
+// AuditLog records a sensitive administrative action. Entries are only ever inserted.
+type AuditLog struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	AuditID   string        `bson:"audit_id" json:"audit_id"`
+	ActorID   string        `bson:"actor_id" json:"actor_id"` // user_id of the admin, or "bootstrap"
+	Action    string        `bson:"action" json:"action"`
+	TargetID  string        `bson:"target_id" json:"target_id"`
+	Details   bson.M        `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Catalog file formats. JSON, an array of movies, is only exported.
+const (
+	CatalogFormatCSV   = "csv"
+	CatalogFormatJSONL = "jsonl"
+	CatalogFormatJSON  = "json"
+)
+
+// ImportSummary is the result of a catalog import job. In a dry run, Inserted and
+// Updated count what the import would have done.
+type ImportSummary struct {
+	Format   string `bson:"format" json:"format"`
+	DryRun   bool   `bson:"dry_run" json:"dry_run"`
+	Rows     int64  `bson:"rows" json:"rows"`
+	Inserted int64  `bson:"inserted" json:"inserted"`
+	Updated  int64  `bson:"updated" json:"updated"`
+	Failed   int64  `bson:"failed" json:"failed"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// Sources of a discovery filter
+const (
+	DiscoverySourceLLM      = "llm"
+	DiscoverySourceKeywords = "keywords"
+)
+
+// Sort orders of discovery results
+const (
+	DiscoverySortRanking    = "ranking"
+	DiscoverySortUserRating = "user_rating"
+	DiscoverySortTitle      = "title"
+)
+
+// DiscoveryRequest is the payload of POST /discover.
+type DiscoveryRequest struct {
+	Query string `json:"query" validate:"required,min=2,max=300"`
+	Limit int    `json:"limit" validate:"omitempty,gte=1,lte=50"` // 20 when left out
+}
+
+// DiscoveryFilter is what a natural language query was understood as. Genre and
+// ranking names are those of the genres and rankings collections.
+type DiscoveryFilter struct {
+	Genres        []string `json:"genres,omitempty"`         // Any of them
+	ExcludeGenres []string `json:"exclude_genres,omitempty"` // None of them
+	Keywords      []string `json:"keywords,omitempty"`       // Any of them, in the title or admin review
+	MinRanking    string   `json:"min_ranking,omitempty"`    // This ranking or better
+	MinUserRating float64  `json:"min_user_rating,omitempty"`
+	YearFrom      int      `json:"year_from,omitempty"`
+	YearTo        int      `json:"year_to,omitempty"`
+	MaxRuntime    int      `json:"max_runtime,omitempty"` // In minutes
+	AgeRatings    []string `json:"age_ratings,omitempty"` // Any of them
+	Languages     []string `json:"languages,omitempty"`   // Any of them
+	Sort          string   `json:"sort,omitempty"`
+}
+
+// DiscoveryResponse holds the movies found for a query and how the query was understood.
+type DiscoveryResponse struct {
+	Query  string          `json:"query"`
+	Source string          `json:"source"`
+	Filter DiscoveryFilter `json:"filter"`
+	Items  []Movie         `json:"items"`
+}
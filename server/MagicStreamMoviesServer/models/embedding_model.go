@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MovieEmbedding is the vector of a movie. TextHash is the SHA-256 of the text it was
+// computed from, so that only movies whose title, genres or review changed are embedded again.
+type MovieEmbedding struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ImdbID    string        `bson:"imdb_id" json:"imdb_id"`
+	Model     string        `bson:"model" json:"model"`
+	Vector    []float32     `bson:"vector" json:"vector"`
+	TextHash  string        `bson:"text_hash" json:"text_hash"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// SimilarMovie is a movie returned by GET /movie/:imdb_id/similar.
+type SimilarMovie struct {
+	Movie
+	Similarity float64 `json:"similarity"` // Cosine similarity, at most 1
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// Sources of an enriched field
+const (
+	EnrichmentSourceLLM   = "llm"
+	EnrichmentSourceAdmin = "admin"
+)
+
+// Enriched fields, as named in MovieEnrichment and in lock lists.
+const (
+	EnrichmentSynopsis        = "synopsis"
+	EnrichmentMoodTags        = "mood_tags"
+	EnrichmentContentWarnings = "content_warnings"
+)
+
+// EnrichmentFields lists the enriched fields.
+var EnrichmentFields = []string{EnrichmentSynopsis, EnrichmentMoodTags, EnrichmentContentWarnings}
+
+// ContentWarnings lists the allowed content warnings.
+var ContentWarnings = []string{
+	"violence", "gore", "sexual content", "nudity", "strong language", "drug use",
+	"alcohol use", "self-harm", "suicide", "abuse", "frightening scenes", "flashing lights",
+}
+
+// MovieEnrichment holds what was generated for a movie by the enrichment job or
+// written by an admin.
+type MovieEnrichment struct {
+	Synopsis        *EnrichedField[string]   `bson:"synopsis,omitempty" json:"synopsis,omitempty"`
+	MoodTags        *EnrichedField[[]string] `bson:"mood_tags,omitempty" json:"mood_tags,omitempty"`
+	ContentWarnings *EnrichedField[[]string] `bson:"content_warnings,omitempty" json:"content_warnings,omitempty"`
+}
+
+// EnrichedField is a value with where it came from. Locked fields are left alone by
+// the enrichment job.
+type EnrichedField[T any] struct {
+	Value         T         `bson:"value" json:"value"`
+	Source        string    `bson:"source" json:"source"`
+	Model         string    `bson:"model,omitempty" json:"model,omitempty"`
+	PromptVersion string    `bson:"prompt_version,omitempty" json:"prompt_version,omitempty"`
+	EditedBy      string    `bson:"edited_by,omitempty" json:"edited_by,omitempty"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+	Locked        bool      `bson:"locked" json:"locked"`
+}
+
+// EnrichmentRunRequest is the payload of POST /admin/enrichment/run. Without ImdbIDs
+// the whole catalog is processed.
+type EnrichmentRunRequest struct {
+	ImdbIDs []string `json:"imdb_ids" validate:"max=1000"`
+	// Force regenerates fields that are up to date with the model and prompt version
+	Force bool `json:"force"`
+}
+
+// EnrichmentEditRequest is the payload of PATCH /admin/movies/:imdb_id/enrichment.
+// Edited fields are locked unless they are listed in Unlock.
+type EnrichmentEditRequest struct {
+	Synopsis        *string   `json:"synopsis" validate:"omitempty,max=1000"`
+	MoodTags        *[]string `json:"mood_tags" validate:"omitempty,max=10,dive,min=2,max=30"`
+	ContentWarnings *[]string `json:"content_warnings" validate:"omitempty,max=12"`
+	Lock            []string  `json:"lock" validate:"dive,oneof=synopsis mood_tags content_warnings"`
+	Unlock          []string  `json:"unlock" validate:"dive,oneof=synopsis mood_tags content_warnings"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Erasure report states
+const (
+	ErasureRunning   = "running"
+	ErasureCompleted = "completed"
+	ErasureFailed    = "failed"
+)
+
+// What an erasure did to the documents of one collection
+const (
+	ErasureActionDelete    = "deleted"
+	ErasureActionAnonymize = "anonymized"
+	ErasureActionRetain    = "retained"
+)
+
+// ErasureReport is the record of an account erasure. It proves what was removed:
+// for each collection, how many documents matched the user before, how many were
+// changed, and how many still match afterwards (which must be zero unless retained).
+type ErasureReport struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ReportID    string        `bson:"report_id" json:"report_id"`
+	JobID       string        `bson:"job_id,omitempty" json:"job_id,omitempty"` // The erasure job that wrote the report
+	UserID      string        `bson:"user_id" json:"user_id"`
+	RequestedBy string        `bson:"requested_by" json:"requested_by"` // The user themself, or the admin who ran it
+	Reason      string        `bson:"reason" json:"reason"`
+	Status      string        `bson:"status" json:"status"`
+	Steps       []ErasureStep `bson:"steps" json:"steps"`
+	Verified    bool          `bson:"verified" json:"verified"`
+	Error       string        `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt   time.Time     `bson:"started_at" json:"started_at"`
+	CompletedAt *time.Time    `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+type ErasureStep struct {
+	Collection string `bson:"collection" json:"collection"`
+	Action     string `bson:"action" json:"action"`
+	Matched    int64  `bson:"matched" json:"matched"`
+	Affected   int64  `bson:"affected" json:"affected"`
+	Remaining  int64  `bson:"remaining" json:"remaining"`
+}
+
+// UserEraseRequest is the payload of the admin endpoint that erases an account.
+type UserEraseRequest struct {
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
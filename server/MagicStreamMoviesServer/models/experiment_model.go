@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Experiment statuses. An experiment goes from draft to running to stopped, and at most
+// one experiment runs at a time.
+const (
+	ExperimentDraft   = "draft"
+	ExperimentRunning = "running"
+	ExperimentStopped = "stopped"
+)
+
+// Experiment compares recommendation strategies by splitting users between variants.
+type Experiment struct {
+	ID           bson.ObjectID       `bson:"_id,omitempty" json:"-"`
+	ExperimentID string              `bson:"experiment_id" json:"experiment_id"`
+	Name         string              `bson:"name" json:"name"`
+	Description  string              `bson:"description,omitempty" json:"description,omitempty"`
+	Variants     []ExperimentVariant `bson:"variants" json:"variants"`
+	Status       string              `bson:"status" json:"status"`
+	CreatedBy    string              `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	StartedAt    *time.Time          `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	StoppedAt    *time.Time          `bson:"stopped_at,omitempty" json:"stopped_at,omitempty"`
+}
+
+// ExperimentVariant is one arm of an experiment. Users are split between variants in
+// proportion to their weights.
+type ExperimentVariant struct {
+	Name     string `bson:"name" json:"name" validate:"required,min=1,max=50"`
+	Strategy string `bson:"strategy" json:"strategy" validate:"required"`
+	Weight   int    `bson:"weight" json:"weight" validate:"gte=1,lte=100"`
+}
+
+// ExperimentRequest is the payload of POST /admin/experiments.
+type ExperimentRequest struct {
+	Name        string              `json:"name" validate:"required,min=1,max=100"`
+	Description string              `json:"description" validate:"max=1000"`
+	Variants    []ExperimentVariant `json:"variants" validate:"required,min=2,max=10,dive"`
+}
+
+// ExperimentPage is one page of experiments.
+type ExperimentPage struct {
+	Items    []Experiment `json:"items"`
+	Page     int64        `json:"page"`
+	PageSize int64        `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+// RecommendationImpression is a movie recommended to a user while an experiment runs.
+// Showing the same movie again to the same user updates the same impression.
+type RecommendationImpression struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ExperimentID string        `bson:"experiment_id" json:"experiment_id"`
+	Variant      string        `bson:"variant" json:"variant"`
+	UserID       string        `bson:"user_id" json:"-"`
+	ImdbID       string        `bson:"imdb_id" json:"imdb_id"`
+	Position     int           `bson:"position" json:"position"` // In the first response showing the movie, from 1
+	ShownCount   int           `bson:"shown_count" json:"shown_count"`
+	FirstShownAt time.Time     `bson:"first_shown_at" json:"first_shown_at"`
+	LastShownAt  time.Time     `bson:"last_shown_at" json:"last_shown_at"`
+	ClickedAt    *time.Time    `bson:"clicked_at,omitempty" json:"clicked_at,omitempty"`
+}
+
+// ExperimentReport compares the variants of an experiment.
+type ExperimentReport struct {
+	ExperimentID string          `json:"experiment_id"`
+	Name         string          `json:"name"`
+	Status       string          `json:"status"`
+	Variants     []VariantReport `json:"variants"`
+	GeneratedAt  time.Time       `json:"generated_at"`
+}
+
+// VariantReport holds the results of one variant. Rates come with their 95% confidence interval.
+type VariantReport struct {
+	Variant      string         `json:"variant"`
+	Strategy     string         `json:"strategy"`
+	Users        int64          `json:"users"`
+	Impressions  int64          `json:"impressions"`
+	Clicks       int64          `json:"clicks"`
+	Watched      int64          `json:"watched"`
+	CTR          ConfidenceRate `json:"ctr"`
+	WatchThrough ConfidenceRate `json:"watch_through"`
+}
+
+// ConfidenceRate is a proportion with the bounds of its confidence interval.
+type ConfidenceRate struct {
+	Value float64 `json:"value"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
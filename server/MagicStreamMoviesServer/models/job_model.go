@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Job statuses
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job types
+const (
+	JobTypeEnrichment    = "enrichment"
+	JobTypeCatalogImport = "catalog_import"
+	JobTypeErasure       = "erasure"
+)
+
+// Job tracks a job started by an admin or a command line tool. Failing items are listed in Errors
+// without failing the job; Error is set when the job as a whole failed.
+type Job struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	JobID      string        `bson:"job_id" json:"job_id"`
+	Type       string        `bson:"type" json:"type"`
+	Key        string        `bson:"key,omitempty" json:"key,omitempty"` // Set for jobs that run once per key, e.g. the erased user
+	Status     string        `bson:"status" json:"status"`
+	Params     bson.M        `bson:"params,omitempty" json:"params,omitempty"`
+	Progress   JobProgress   `bson:"progress" json:"progress"`
+	Errors     []JobError    `bson:"errors,omitempty" json:"errors,omitempty"` // The first MaxJobErrors
+	Result     bson.M        `bson:"result,omitempty" json:"result,omitempty"`
+	Error      string        `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy  string        `bson:"created_by" json:"created_by"`
+	StartedAt  time.Time     `bson:"started_at" json:"started_at"`
+	UpdatedAt  time.Time     `bson:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time    `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// MaxJobErrors is how many item errors a job keeps; Progress.Failed counts them all.
+const MaxJobErrors = 1000
+
+type JobProgress struct {
+	Total     int64 `bson:"total" json:"total"`
+	Processed int64 `bson:"processed" json:"processed"`
+	Succeeded int64 `bson:"succeeded" json:"succeeded"`
+	Skipped   int64 `bson:"skipped" json:"skipped"`
+	Failed    int64 `bson:"failed" json:"failed"`
+}
+
+// JobError is an item a job could not process.
+type JobError struct {
+	Item    string `bson:"item" json:"item"`
+	Message string `bson:"message" json:"message"`
+}
+
+// JobPage is one page of jobs.
+type JobPage struct {
+	Items    []Job `json:"items"`
+	Page     int64 `json:"page"`
+	PageSize int64 `json:"page_size"`
+	Total    int64 `json:"total"`
+}
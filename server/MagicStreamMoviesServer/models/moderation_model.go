@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Moderation statuses, of queue items and of the content they hold.
+// Superseded items were replaced by an edit or withdrawn by deleting the content.
+const (
+	ModerationPending    = "pending"
+	ModerationApproved   = "approved"
+	ModerationRejected   = "rejected"
+	ModerationSuperseded = "superseded"
+)
+
+// Moderation categories
+const (
+	ModerationCategorySpam  = "spam"
+	ModerationCategoryAbuse = "abuse"
+)
+
+// Kinds of user content that go through moderation.
+const (
+	ModerationContentReview = "review"
+)
+
+// ModerationVerdict is what a classifier says about a piece of text.
+type ModerationVerdict struct {
+	Flagged    bool     `bson:"flagged" json:"flagged"`
+	Categories []string `bson:"categories,omitempty" json:"categories,omitempty"`
+	Reason     string   `bson:"reason,omitempty" json:"reason,omitempty"`
+	Classifier string   `bson:"classifier" json:"classifier"` // "llm", "rules" or "none"
+}
+
+// ModerationItem is flagged text held for an admin decision.
+type ModerationItem struct {
+	ID             bson.ObjectID     `bson:"_id,omitempty" json:"-"`
+	ItemID         string            `bson:"item_id" json:"item_id"`
+	ContentType    string            `bson:"content_type" json:"content_type"`
+	ContentID      string            `bson:"content_id" json:"content_id"`
+	UserID         string            `bson:"user_id" json:"user_id"`
+	Text           string            `bson:"text" json:"text"`
+	Verdict        ModerationVerdict `bson:"verdict" json:"verdict"`
+	Status         string            `bson:"status" json:"status"`
+	DecisionReason string            `bson:"decision_reason,omitempty" json:"decision_reason,omitempty"`
+	DecidedBy      string            `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+	CreatedAt      time.Time         `bson:"created_at" json:"created_at"`
+	DecidedAt      *time.Time        `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+}
+
+// ModerationDecisionRequest is the payload of the approve and reject endpoints.
+// A reason is required to reject.
+type ModerationDecisionRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// ModerationPage is one page of the moderation queue.
+type ModerationPage struct {
+	Items    []ModerationItem `json:"items"`
+	Page     int64            `json:"page"`
+	PageSize int64            `json:"page_size"`
+	Total    int64            `json:"total"`
+}
@@ -16,6 +16,13 @@ type Ranking struct {
 	RankingName  string `bson:"ranking_name" json:"ranking_name" validate:"required"`
 }
 
+// MovieSchemaVersion is the version of the movie documents written by this code.
+// Older documents are brought up to date by the migrations package.
+const MovieSchemaVersion = 3
+
+// AgeRatings lists the allowed age ratings. NR means not rated.
+var AgeRatings = []string{"G", "PG", "PG-13", "R", "NC-17", "NR"}
+
 type Movie struct {
 	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
 	ImdbID      string        `bson:"imdb_id" json:"imdb_id" validate:"required"`
@@ -25,4 +32,32 @@ type Movie struct {
 	Genre       []Genre       `bson:"genre" json:"genre" validate:"required,dive"`
 	AdminReview string        `bson:"admin_review" json:"admin_review"`
 	Ranking     Ranking       `bson:"ranking" json:"ranking" validate:"required"`
+	UserRating  *UserRating   `bson:"user_rating,omitempty" json:"user_rating,omitempty"`
+	// Generated by the enrichment job or written by admins
+	Enrichment *MovieEnrichment `bson:"enrichment,omitempty" json:"enrichment,omitempty"`
+
+	// Since schema version 2. Zero values mean unknown.
+	ReleaseYear    int      `bson:"release_year,omitempty" json:"release_year,omitempty" validate:"omitempty,gte=1888,lte=2100"`
+	RuntimeMinutes int      `bson:"runtime_minutes,omitempty" json:"runtime_minutes,omitempty" validate:"omitempty,gte=1,lte=1000"`
+	Cast           []string `bson:"cast" json:"cast" validate:"max=200,dive,min=1,max=200"`
+	Directors      []string `bson:"directors" json:"directors" validate:"max=20,dive,min=1,max=200"`
+	AgeRating      string   `bson:"age_rating,omitempty" json:"age_rating,omitempty" validate:"omitempty,oneof=G PG PG-13 R NC-17 NR"`
+	Languages      []string `bson:"languages" json:"languages" validate:"max=20,dive,bcp47_language_tag"` // BCP 47 tags such as "en" or "pt-BR"
+	Synopsis       string   `bson:"synopsis,omitempty" json:"synopsis,omitempty" validate:"max=2000"`     // Supplied with the movie; generated ones live in Enrichment
+	SchemaVersion  int      `bson:"schema_version" json:"schema_version"`
+}
+
+// UserRating aggregates the ratings users gave a movie. It is only changed through
+// atomic updates when a review is written, edited or deleted.
+type UserRating struct {
+	Average float64 `bson:"average" json:"average"` // Rounded to 2 decimals, 0 without ratings
+	Count   int64   `bson:"count" json:"count"`
+	Sum     int64   `bson:"sum" json:"-"`
+}
+
+// MovieSummary is the part of a movie shown next to a watch event or list item.
+type MovieSummary struct {
+	Title      string `bson:"title" json:"title"`
+	PosterPath string `bson:"poster_path" json:"poster_path"`
+	YoutubeID  string `bson:"youtube_id" json:"youtube_id"`
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Purposes of one-time tokens. A token can only be consumed for the purpose it was issued for.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// OneTimeToken is a single-use, time-limited token sent to a user by email.
+// Only the SHA-256 hash of the token is stored.
+type OneTimeToken struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	TokenHash string        `bson:"token_hash" json:"-"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	Purpose   string        `bson:"purpose" json:"purpose"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time    `bson:"used_at,omitempty" json:"used_at,omitempty"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
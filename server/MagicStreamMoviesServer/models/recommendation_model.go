@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Recommendation sources
+const (
+	RecommendationSourceItemCF = "item_cf"
+)
+
+// UserRecommendations are the precomputed recommendations of a user, best first.
+// They are rewritten by the recommendation job.
+type UserRecommendations struct {
+	ID         bson.ObjectID        `bson:"_id,omitempty" json:"-"`
+	UserID     string               `bson:"user_id" json:"user_id"`
+	Source     string               `bson:"source" json:"source"`
+	Items      []RecommendationItem `bson:"items" json:"items"`
+	ComputedAt time.Time            `bson:"computed_at" json:"computed_at"`
+}
+
+type RecommendationItem struct {
+	ImdbID string  `bson:"imdb_id" json:"imdb_id"`
+	Score  float64 `bson:"score" json:"score"`
+	// Because lists the movies of the user that contributed most to the score
+	Because []string `bson:"because,omitempty" json:"because,omitempty"`
+}
+
+// RecommendedMovie is a movie returned by GET /recommended-movies, with why it was picked.
+type RecommendedMovie struct {
+	Movie
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Review sort orders accepted by GET /movie/:imdb_id/reviews.
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortOldest  = "oldest"
+	ReviewSortHighest = "highest"
+	ReviewSortLowest  = "lowest"
+)
+
+// Review is a user's rating of a movie, with an optional written review.
+// Each user has at most one review per movie.
+type Review struct {
+	ID       bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ReviewID string        `bson:"review_id" json:"review_id"`
+	UserID   string        `bson:"user_id" json:"-"`
+	ImdbID   string        `bson:"imdb_id" json:"imdb_id"`
+	Rating   int           `bson:"rating" json:"rating"` // 1 to 10
+	Text     string        `bson:"text,omitempty" json:"text,omitempty"`
+	// Set when the review has text: flagged text stays hidden from others until approved
+	ModerationStatus string    `bson:"moderation_status,omitempty" json:"moderation_status,omitempty"`
+	ModerationReason string    `bson:"moderation_reason,omitempty" json:"moderation_reason,omitempty"` // Why it was rejected
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+
+	// Joined from the users collection when listing a movie's reviews
+	Author string `bson:"author,omitempty" json:"author,omitempty"`
+}
+
+// ReviewRequest is the payload of POST /movie/:imdb_id/reviews.
+type ReviewRequest struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=10"`
+	Text   string `json:"text" validate:"max=5000"`
+}
+
+// ReviewUpdateRequest is the payload of PATCH /reviews/:review_id. Fields left out are not changed;
+// an empty text removes the written review.
+type ReviewUpdateRequest struct {
+	Rating *int    `json:"rating" validate:"omitempty,min=1,max=10"`
+	Text   *string `json:"text" validate:"omitempty,max=5000"`
+}
+
+// ReviewPage is one page of reviews.
+type ReviewPage struct {
+	Items    []Review `json:"items"`
+	Page     int64    `json:"page"`
+	PageSize int64    `json:"page_size"`
+	Total    int64    `json:"total"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// List kinds. Every user has exactly one watchlist, created on first use.
+const (
+	ListKindWatchlist = "watchlist"
+	ListKindCustom    = "custom"
+)
+
+// List visibility. Public lists can be read by anyone; private lists only by their
+// owner, or through a share link.
+const (
+	ListVisibilityPrivate = "private"
+	ListVisibilityPublic  = "public"
+)
+
+// UserList is a watchlist or a named list of movies, in the order chosen by the user.
+type UserList struct {
+	ID             bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ListID         string        `bson:"list_id" json:"list_id"`
+	UserID         string        `bson:"user_id" json:"user_id"`
+	Name           string        `bson:"name" json:"name"`
+	Kind           string        `bson:"kind" json:"kind"`
+	Visibility     string        `bson:"visibility" json:"visibility"`
+	ShareTokenHash string        `bson:"share_token_hash,omitempty" json:"-"`
+	Shared         bool          `bson:"-" json:"shared"` // A share link exists
+	Items          []ListItem    `bson:"items" json:"items"`
+	CreatedAt      time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+type ListItem struct {
+	ImdbID  string    `bson:"imdb_id" json:"imdb_id"`
+	AddedAt time.Time `bson:"added_at" json:"added_at"`
+
+	// Filled in from the movies collection when the list is read
+	Movie *MovieSummary `bson:"-" json:"movie,omitempty"`
+}
+
+// PublicUserList is what others see of a public or shared list.
+type PublicUserList struct {
+	ListID    string     `json:"list_id"`
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Items     []ListItem `json:"items"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ListCreateRequest is the payload of POST /me/lists.
+type ListCreateRequest struct {
+	Name       string `json:"name" validate:"required,min=1,max=100"`
+	Visibility string `json:"visibility" validate:"omitempty,oneof=private public"`
+}
+
+// ListUpdateRequest is the payload of PATCH /me/lists/:list_id. Fields left out are not changed.
+type ListUpdateRequest struct {
+	Name       *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=private public"`
+}
+
+// ListItemRequest adds a movie to a list.
+type ListItemRequest struct {
+	ImdbID string `json:"imdb_id" validate:"required"`
+}
+
+// ListReorderRequest gives the new order of a list; it must contain exactly the movies already in it.
+type ListReorderRequest struct {
+	ImdbIDs []string `json:"imdb_ids" validate:"required"`
+}
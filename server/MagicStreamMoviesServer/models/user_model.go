@@ -6,19 +6,141 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// User roles
+const (
+	RoleAdmin = "ADMIN"
+	RoleUser  = "USER"
+)
+
+// MaxSessions is how many sessions a user can have open at once. Opening one more ends
+// the oldest.
+const MaxSessions = 20
+
+// Session is a login on one device. Its tokens carry the session ID; only hashes of the
+// current ones are stored, so refreshing makes the previous tokens useless.
+type Session struct {
+	SessionID        string    `bson:"session_id" json:"session_id"`
+	TokenHash        string    `bson:"token_hash" json:"-"`
+	RefreshTokenHash string    `bson:"refresh_token_hash" json:"-"`
+	MFA              bool      `bson:"mfa" json:"mfa"` // Opened with a second factor
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+	RefreshedAt      time.Time `bson:"refreshed_at" json:"refreshed_at"`
+	ExpiresAt        time.Time `bson:"expires_at" json:"expires_at"` // When its refresh token expires
+}
+
+// UserSchemaVersion is the version of the user documents written by this code.
+// Older documents are brought up to date by the migrations package.
+const UserSchemaVersion = 3
+
 type User struct {
-	ID             bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	UserID         string        `bson:"user_id" json:"user_id"`
-	FirstName      string        `bson:"first_name" json:"first_name" validate:"required,min=2,max=100"`
-	LastName       string        `bson:"last_name" json:"last_name" validate:"required"`
-	Email          string        `bson:"email" json:"email" validate:"required"`
-	Password       string        `bson:"password" json:"password" validate:"required,min=6"`
-	Role           string        `bson:"role" json:"role" validate:"oneof=ADMIN USER"`
-	CreatedAt      time.Time     `bson:"created_at" json:"created_at"`
-	UpdatedAt      time.Time     `bson:"updated_at" json:"updated_at"`
-	Token          string        `bson:"token" json:"token"` // Used for authentication and authorization
-	RefreshToken   string        `bson:"refresh_token" json:"refresh_token"`
-	FavoriteGenres []Genre       `bson:"favourite_genres" json:"favourite_genres" validate:"required,min=1,dive"`
+	ID              bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	UserID          string        `bson:"user_id" json:"user_id"`
+	FirstName       string        `bson:"first_name" json:"first_name" validate:"required,min=2,max=100"`
+	LastName        string        `bson:"last_name" json:"last_name" validate:"required"`
+	Email           string        `bson:"email" json:"email" validate:"required,email"`
+	Password        string        `bson:"password" json:"-" validate:"required,min=6"` // bcrypt hash, never serialized
+	EmailVerified   bool          `bson:"email_verified" json:"email_verified"`
+	EmailVerifiedAt *time.Time    `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	Role            string        `bson:"role" json:"role" validate:"oneof=ADMIN USER"`
+	CreatedAt       time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time     `bson:"updated_at" json:"updated_at"`
+	Sessions        []Session     `bson:"sessions,omitempty" json:"-"` // Open logins, one per device
+	FavoriteGenres  []Genre       `bson:"favourite_genres" json:"favourite_genres" validate:"required,min=1,dive"`
+	SchemaVersion   int           `bson:"schema_version" json:"-"`
+
+	// Set by an admin; disabled accounts cannot log in and their sessions and API keys are rejected
+	Disabled       bool       `bson:"disabled,omitempty" json:"disabled"`
+	DisabledAt     *time.Time `bson:"disabled_at,omitempty" json:"disabled_at,omitempty"`
+	DisabledReason string     `bson:"disabled_reason,omitempty" json:"disabled_reason,omitempty"`
+
+	// Two-factor authentication (TOTP). Secrets and recovery code hashes never leave the server.
+	TOTPEnabled       bool     `bson:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"` // Set during enrollment, until the first code is confirmed
+	TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`      // Last accepted time step, to prevent code replay
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`      // SHA-256 hashes of the unused recovery codes
+
+	// Identity at the OpenID Connect provider, set once the account is linked to it
+	OIDCIssuer  string `bson:"oidc_issuer,omitempty" json:"-"`
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"-"`
+}
+
+// UserRegister is the payload accepted by POST /register. Everything else on
+// models.User (role, IDs, tokens, timestamps) is assigned by the server.
+type UserRegister struct {
+	FirstName      string  `json:"first_name" validate:"required,min=2,max=100"`
+	LastName       string  `json:"last_name" validate:"required"`
+	Email          string  `json:"email" validate:"required,email"`
+	Password       string  `json:"password" validate:"required,min=6"`
+	FavoriteGenres []Genre `json:"favourite_genres" validate:"required,min=1,dive"`
+}
+
+// RoleUpdateRequest is the payload of the admin endpoint that promotes or demotes a user.
+type RoleUpdateRequest struct {
+	Role   string `json:"role" validate:"required,oneof=ADMIN USER"`
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
+// UserPage is one page of the admin user listing.
+type UserPage struct {
+	Users    []User `json:"users"`
+	Page     int64  `json:"page"`
+	PageSize int64  `json:"page_size"`
+	Total    int64  `json:"total"`
+}
+
+// UserDisableRequest is the payload of the admin endpoint that disables an account.
+type UserDisableRequest struct {
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
+// MFALoginRequest is the second step of a login with two-factor authentication.
+// Either a TOTP code or one of the recovery codes must be given.
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// TOTPCodeRequest carries a code from the user's authenticator app (or a recovery code where allowed).
+type TOTPCodeRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// ProfileUpdateRequest is the payload of PATCH /me. Fields left out are not changed.
+type ProfileUpdateRequest struct {
+	FirstName      *string  `json:"first_name" validate:"omitempty,min=2,max=100"`
+	LastName       *string  `json:"last_name" validate:"omitempty,min=1,max=100"`
+	FavoriteGenres *[]Genre `json:"favourite_genres" validate:"omitempty,min=1,dive"`
+}
+
+// PasswordChangeRequest is the payload of POST /me/password.
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// AccountDeleteRequest confirms DELETE /me. The password is required for accounts that have one.
+type AccountDeleteRequest struct {
+	Password string `json:"password"`
+}
+
+// ProfileResponse is what the user sees of their own account.
+type ProfileResponse struct {
+	UserID          string     `json:"user_id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Role            string     `json:"role"`
+	FavoriteGenres  []Genre    `json:"favourite_genres"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	SingleSignOn    bool       `json:"single_sign_on"` // Linked to the OIDC provider
+	HasPassword     bool       `json:"has_password"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type UserLogin struct {
@@ -27,12 +149,14 @@ type UserLogin struct {
 }
 
 type UserResponse struct {
-	UserID         string  `json:"user_id"`
-	FirstName      string  `json:"first_name"`
-	LastName       string  `json:"last_name"`
-	Email          string  `json:"email"`
-	Role           string  `json:"role"`
-	Token          string  `json:"token"`
-	RefreshToken   string  `json:"refresh_token"`
-	FavoriteGenres []Genre `json:"favourite_genres"`
+	UserID          string     `json:"user_id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	EmailVerified   bool       `bson:"email_verified" json:"email_verified"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	Role            string     `json:"role"`
+	Token           string     `json:"token"`
+	RefreshToken    string     `json:"refresh_token"`
+	FavoriteGenres  []Genre    `json:"favourite_genres"`
 }
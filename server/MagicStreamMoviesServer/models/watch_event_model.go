@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WatchEvent is one viewing of a movie by a user, kept up to date by the player's
+// progress heartbeats. A new viewing starts once the previous one is finished.
+type WatchEvent struct {
+	ID              bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID          string        `bson:"user_id" json:"-"`
+	ImdbID          string        `bson:"imdb_id" json:"imdb_id"`
+	PositionSeconds float64       `bson:"position_seconds" json:"position_seconds"`
+	DurationSeconds float64       `bson:"duration_seconds" json:"duration_seconds"`
+	Progress        float64       `bson:"progress" json:"progress"` // Between 0 and 1
+	Finished        bool          `bson:"finished" json:"finished"`
+	StartedAt       time.Time     `bson:"started_at" json:"started_at"`
+	UpdatedAt       time.Time     `bson:"updated_at" json:"updated_at"`
+	FinishedAt      *time.Time    `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+
+	// Joined from the movies collection when listing
+	Movie *MovieSummary `bson:"movie,omitempty" json:"movie,omitempty"`
+}
+
+// WatchProgressRequest is a progress heartbeat sent by the player.
+type WatchProgressRequest struct {
+	ImdbID   string  `json:"imdb_id" validate:"required"`
+	Position float64 `json:"position" validate:"gte=0"`
+	Duration float64 `json:"duration" validate:"gt=0"`
+}
+
+// WatchHistoryPage is one page of a user's watch history.
+type WatchHistoryPage struct {
+	Items    []WatchEvent `json:"items"`
+	Page     int64        `json:"page"`
+	PageSize int64        `json:"page_size"`
+	Total    int64        `json:"total"`
+}
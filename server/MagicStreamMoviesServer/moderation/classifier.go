@@ -0,0 +1,73 @@
+// Package moderation screens user-submitted text for spam and abuse, and holds
+// flagged text in the moderation_queue collection until an admin decides on it.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// Classifier tells whether a piece of text should be held for review.
+type Classifier interface {
+	Classify(ctx context.Context, text string) (models.ModerationVerdict, error)
+}
+
+// Chain runs classifiers in order and returns the first verdict that flags the text.
+// A classifier that fails is skipped; the chain only fails if all of them do.
+type Chain []Classifier
+
+func (chain Chain) Classify(ctx context.Context, text string) (models.ModerationVerdict, error) {
+	var verdict models.ModerationVerdict
+	var lastErr error
+	ok := false
+
+	for _, classifier := range chain {
+		v, err := classifier.Classify(ctx, text)
+		if err != nil {
+			log.Println("Moderation classifier failed:", err)
+			lastErr = err
+			continue
+		}
+		if v.Flagged {
+			return v, nil
+		}
+		verdict, ok = v, true
+	}
+
+	if !ok {
+		if lastErr == nil {
+			lastErr = errors.New("moderation: no classifier")
+		}
+		return models.ModerationVerdict{}, lastErr
+	}
+	return verdict, nil
+}
+
+// Default returns the classifier selected by MODERATION_CLASSIFIER: "llm" (default)
+// runs the rules first and then asks the language model, "rules" never leaves the server.
+var Default = sync.OnceValue(func() Classifier {
+	rules := NewRuleClassifier()
+	if os.Getenv("MODERATION_CLASSIFIER") == "rules" {
+		return rules
+	}
+	return Chain{rules, &LLMClassifier{}}
+})
+
+// Check classifies text with the default classifier. If no classifier can answer,
+// the text is held, so that nothing unscreened gets published.
+func Check(ctx context.Context, text string) models.ModerationVerdict {
+	return check(ctx, Default(), text)
+}
+
+func check(ctx context.Context, classifier Classifier, text string) models.ModerationVerdict {
+	verdict, err := classifier.Classify(ctx, text)
+	if err != nil {
+		return models.ModerationVerdict{Flagged: true, Reason: "Could not be screened automatically", Classifier: "none"}
+	}
+	return verdict
+}
@@ -0,0 +1,107 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrNotPending is returned when deciding on an item that was already decided or superseded.
+var ErrNotPending = errors.New("moderation: item is not pending")
+
+// contents maps each moderated content type to where it is stored. Decisions set
+// moderation_status (and moderation_reason on rejection) on the content document.
+var contents = map[string]struct{ collection, idField string }{
+	models.ModerationContentReview: {"reviews", "review_id"},
+}
+
+// Hold puts flagged text in the moderation queue. Any earlier pending item for the
+// same content is superseded first, so each content has at most one pending item.
+func Hold(ctx context.Context, contentType, contentID, userID, text string, verdict models.ModerationVerdict, client *mongo.Client) error {
+	if _, ok := contents[contentType]; !ok {
+		return fmt.Errorf("moderation: unknown content type %q", contentType)
+	}
+	if err := Withdraw(ctx, contentType, contentID, client); err != nil {
+		return err
+	}
+
+	_, err := database.OpenCollection("moderation_queue", client).InsertOne(ctx, models.ModerationItem{
+		ItemID:      bson.NewObjectID().Hex(),
+		ContentType: contentType,
+		ContentID:   contentID,
+		UserID:      userID,
+		Text:        text,
+		Verdict:     verdict,
+		Status:      models.ModerationPending,
+		CreatedAt:   time.Now(),
+	})
+	return err
+}
+
+// Withdraw supersedes the pending item of a content, e.g. when it is edited or deleted.
+func Withdraw(ctx context.Context, contentType, contentID string, client *mongo.Client) error {
+	_, err := database.OpenCollection("moderation_queue", client).UpdateMany(ctx,
+		bson.M{"content_type": contentType, "content_id": contentID, "status": models.ModerationPending},
+		bson.M{"$set": bson.M{"status": models.ModerationSuperseded, "decided_at": time.Now()}},
+	)
+	return err
+}
+
+// Decide approves or rejects a pending item and applies the decision to its content.
+func Decide(ctx context.Context, itemID string, approve bool, reason, adminID string, client *mongo.Client) (*models.ModerationItem, error) {
+	queue := database.OpenCollection("moderation_queue", client)
+
+	status := models.ModerationRejected
+	if approve {
+		status = models.ModerationApproved
+	}
+	set := bson.M{"status": status, "decided_by": adminID, "decided_at": time.Now()}
+	if reason != "" {
+		set["decision_reason"] = reason
+	}
+
+	var item models.ModerationItem
+	err := queue.FindOneAndUpdate(ctx,
+		bson.M{"item_id": itemID, "status": models.ModerationPending},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Tell a missing item from one that is no longer pending
+		count, countErr := queue.CountDocuments(ctx, bson.M{"item_id": itemID})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count > 0 {
+			return nil, ErrNotPending
+		}
+		return nil, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := contents[item.ContentType]
+	if !ok {
+		return nil, fmt.Errorf("moderation: unknown content type %q", item.ContentType)
+	}
+
+	update := bson.M{"$set": bson.M{"moderation_status": status}, "$unset": bson.M{"moderation_reason": ""}}
+	if !approve {
+		update = bson.M{"$set": bson.M{"moderation_status": status, "moderation_reason": reason}}
+	}
+	// The content may have been deleted since; the decision stands for the record
+	filter := bson.M{content.idField: item.ContentID, "moderation_status": models.ModerationPending}
+	if _, err := database.OpenCollection(content.collection, client).UpdateOne(ctx, filter, update); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
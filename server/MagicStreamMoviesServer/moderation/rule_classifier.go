@@ -0,0 +1,99 @@
+package moderation
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+var (
+	linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|ru|xyz|io|biz|info)\b`)
+	wordPattern = regexp.MustCompile(`[\p{L}\p{N}']+`)
+)
+
+// defaultBlockedTerms are always flagged as abuse. MODERATION_BLOCKED_TERMS adds more.
+var defaultBlockedTerms = []string{"kill yourself", "kys", "go die", "idiot", "moron", "loser"}
+
+// RuleClassifier flags text with simple rules. It needs no network, gives the same
+// answer every time, and is used offline and in front of the LLM classifier.
+type RuleClassifier struct {
+	// MaxLinks is the number of links allowed before text counts as spam.
+	MaxLinks int
+	// BlockedTerms are lower-case words or phrases that count as abuse.
+	BlockedTerms []string
+}
+
+// NewRuleClassifier returns a RuleClassifier allowing one link, with the default
+// blocked terms and those in MODERATION_BLOCKED_TERMS (comma separated).
+func NewRuleClassifier() *RuleClassifier {
+	terms := append([]string(nil), defaultBlockedTerms...)
+	for _, term := range strings.Split(os.Getenv("MODERATION_BLOCKED_TERMS"), ",") {
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return &RuleClassifier{MaxLinks: 1, BlockedTerms: terms}
+}
+
+func (r *RuleClassifier) Classify(ctx context.Context, text string) (models.ModerationVerdict, error) {
+	verdict := models.ModerationVerdict{Classifier: "rules"}
+	var reasons []string
+
+	if links := len(linkPattern.FindAllString(text, -1)); links > r.MaxLinks {
+		verdict.Categories = append(verdict.Categories, models.ModerationCategorySpam)
+		reasons = append(reasons, "too many links")
+	} else if repetitive(text) {
+		verdict.Categories = append(verdict.Categories, models.ModerationCategorySpam)
+		reasons = append(reasons, "repeated text")
+	}
+
+	// Match whole words, so that "moron" does not catch "oxymoron"
+	normalized := " " + strings.Join(wordPattern.FindAllString(strings.ToLower(text), -1), " ") + " "
+	for _, term := range r.BlockedTerms {
+		if strings.Contains(normalized, " "+term+" ") {
+			verdict.Categories = append(verdict.Categories, models.ModerationCategoryAbuse)
+			reasons = append(reasons, "blocked term")
+			break
+		}
+	}
+
+	if len(reasons) > 0 {
+		verdict.Flagged = true
+		verdict.Reason = "Rule match: " + strings.Join(reasons, ", ")
+	}
+	return verdict, nil
+}
+
+// repetitive reports text made of a character run of 10 or more, or of the same
+// word 5 times in a row.
+func repetitive(text string) bool {
+	run := 0
+	var last rune
+	for _, r := range text {
+		if r == last && r != ' ' {
+			run++
+			if run >= 10 {
+				return true
+			}
+		} else {
+			run, last = 1, r
+		}
+	}
+
+	words := wordPattern.FindAllString(strings.ToLower(text), -1)
+	run = 0
+	for i := range words {
+		if i > 0 && words[i] == words[i-1] {
+			run++
+			if run >= 4 {
+				return true
+			}
+		} else {
+			run = 0
+		}
+	}
+	return false
+}
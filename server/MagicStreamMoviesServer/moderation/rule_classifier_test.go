@@ -0,0 +1,141 @@
+package moderation
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+func TestRuleClassifierClassify(t *testing.T) {
+	classifier := &RuleClassifier{MaxLinks: 1, BlockedTerms: defaultBlockedTerms}
+
+	tests := []struct {
+		name       string
+		text       string
+		categories []string
+	}{
+		{"clean review", "A slow start, but the last hour is wonderful. The score is great too.", nil},
+		{"harsh criticism", "The plot is a mess and the acting is dreadful. Avoid.", nil},
+		{"one link", "The trailer is at https://example.com/trailer if you want it.", nil},
+		{"two links", "Watch it free at https://free-movies.example and www.cheap-dvds.example now", []string{models.ModerationCategorySpam}},
+		{"bare domains", "best deals on cheapflix.com and moviez.xyz", []string{models.ModerationCategorySpam}},
+		{"character run", "Sooooooooooo good", []string{models.ModerationCategorySpam}},
+		{"nine repeated characters", "Sooooooooo good", nil},
+		{"repeated word", "buy buy buy buy buy tickets", []string{models.ModerationCategorySpam}},
+		{"word repeated four times", "no no no no, not this one", nil},
+		{"repeated word across punctuation and case", "Spam, SPAM. spam! Spam? spam", []string{models.ModerationCategorySpam}},
+		{"blocked term", "Whoever likes this is a moron.", []string{models.ModerationCategoryAbuse}},
+		{"blocked term in capitals", "What an IDIOT", []string{models.ModerationCategoryAbuse}},
+		{"blocked phrase", "Go die, seriously", []string{models.ModerationCategoryAbuse}},
+		{"blocked term inside a word", "The ending is an oxymoron: a happy tragedy.", nil},
+		{"blocked term as a prefix", "The morons of the story are the best part", nil},
+		{"phrase split by punctuation", "Kill yourself... said the villain", []string{models.ModerationCategoryAbuse}},
+		{"spam and abuse", "loser, go to https://a.example and https://b.example", []string{models.ModerationCategorySpam, models.ModerationCategoryAbuse}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict, err := classifier.Classify(context.Background(), test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Flagged != (len(test.categories) > 0) {
+				t.Errorf("Flagged = %v, reason %q", verdict.Flagged, verdict.Reason)
+			}
+			if !slices.Equal(verdict.Categories, test.categories) {
+				t.Errorf("Categories = %v, want %v", verdict.Categories, test.categories)
+			}
+			if verdict.Classifier != "rules" {
+				t.Errorf("Classifier = %q", verdict.Classifier)
+			}
+			if verdict.Flagged && !strings.HasPrefix(verdict.Reason, "Rule match: ") {
+				t.Errorf("Reason = %q", verdict.Reason)
+			}
+		})
+	}
+}
+
+func TestNewRuleClassifierBlockedTermsFromEnv(t *testing.T) {
+	t.Setenv("MODERATION_BLOCKED_TERMS", " Clown , ,total fool")
+	classifier := NewRuleClassifier()
+
+	for _, text := range []string{"what a clown", "a TOTAL fool wrote this"} {
+		verdict, _ := classifier.Classify(context.Background(), text)
+		if !verdict.Flagged {
+			t.Errorf("%q should be flagged", text)
+		}
+	}
+	if verdict, _ := classifier.Classify(context.Background(), "an idiot"); !verdict.Flagged {
+		t.Error("the default terms should still apply")
+	}
+}
+
+// stubClassifier returns a fixed verdict or error and counts its calls.
+type stubClassifier struct {
+	verdict models.ModerationVerdict
+	err     error
+	calls   int
+}
+
+func (s *stubClassifier) Classify(ctx context.Context, text string) (models.ModerationVerdict, error) {
+	s.calls++
+	return s.verdict, s.err
+}
+
+func TestChainClassify(t *testing.T) {
+	clean := models.ModerationVerdict{Classifier: "clean"}
+	flagged := models.ModerationVerdict{Flagged: true, Classifier: "flagged"}
+	failing := func() *stubClassifier { return &stubClassifier{err: context.DeadlineExceeded} }
+
+	t.Run("first flag wins", func(t *testing.T) {
+		last := &stubClassifier{verdict: clean}
+		verdict, err := Chain{&stubClassifier{verdict: flagged}, last}.Classify(context.Background(), "text")
+		if err != nil || verdict.Classifier != "flagged" {
+			t.Errorf("verdict = %+v, err = %v", verdict, err)
+		}
+		if last.calls != 0 {
+			t.Error("classifiers after a flag should not run")
+		}
+	})
+	t.Run("clean runs every classifier", func(t *testing.T) {
+		last := &stubClassifier{verdict: models.ModerationVerdict{Classifier: "last"}}
+		verdict, err := Chain{&stubClassifier{verdict: clean}, last}.Classify(context.Background(), "text")
+		if err != nil || verdict.Flagged || verdict.Classifier != "last" {
+			t.Errorf("verdict = %+v, err = %v", verdict, err)
+		}
+	})
+	t.Run("falls back when a classifier fails", func(t *testing.T) {
+		verdict, err := Chain{&stubClassifier{verdict: clean}, failing()}.Classify(context.Background(), "text")
+		if err != nil || verdict.Flagged || verdict.Classifier != "clean" {
+			t.Errorf("verdict = %+v, err = %v", verdict, err)
+		}
+		verdict, err = Chain{failing(), &stubClassifier{verdict: flagged}}.Classify(context.Background(), "text")
+		if err != nil || verdict.Classifier != "flagged" {
+			t.Errorf("verdict = %+v, err = %v", verdict, err)
+		}
+	})
+	t.Run("fails when every classifier fails", func(t *testing.T) {
+		if _, err := (Chain{failing(), failing()}).Classify(context.Background(), "text"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("empty chain fails", func(t *testing.T) {
+		if _, err := (Chain{}).Classify(context.Background(), "text"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCheckFailsClosed(t *testing.T) {
+	verdict := check(context.Background(), Chain{&stubClassifier{err: context.DeadlineExceeded}}, "text")
+	if !verdict.Flagged || verdict.Classifier != "none" {
+		t.Errorf("unscreened text should be held, got %+v", verdict)
+	}
+
+	verdict = check(context.Background(), Chain{NewRuleClassifier(), &stubClassifier{err: context.DeadlineExceeded}}, "A fine film.")
+	if verdict.Flagged {
+		t.Errorf("text passed by the rules should not be held when the LLM is down, got %+v", verdict)
+	}
+}
@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// idTokenLeeway allows for clock skew between us and the identity provider.
+const idTokenLeeway = time.Minute
+
+// IDTokenClaims are the standard claims we read from a verified ID token.
+type IDTokenClaims struct {
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	GivenName       string       `json:"given_name"`
+	FamilyName      string       `json:"family_name"`
+	Name            string       `json:"name"`
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	// AMR lists the authentication methods used at the provider, e.g. "pwd", "otp", "mfa" (RFC 8176)
+	AMR []string `json:"amr"`
+	jwt.RegisteredClaims
+
+	// Groups are read from the claim named by Config.GroupsClaim
+	Groups []string `json:"-"`
+}
+
+// MultiFactor reports whether the provider says the user authenticated with more than one factor.
+func (c *IDTokenClaims) MultiFactor() bool {
+	return slices.Contains(c.AMR, "mfa")
+}
+
+// CanLinkAccount reports whether an existing local account with the same email may be
+// linked to this identity. The provider must have verified the email, so that the identity
+// owns it, and so must the account: otherwise anyone could register the address with a
+// password of their choosing and take over the real owner's first single sign-on.
+// Accounts already linked to an identity are never linked again.
+func (c *IDTokenClaims) CanLinkAccount(accountEmailVerified, accountLinked bool) bool {
+	return bool(c.EmailVerified) && accountEmailVerified && !accountLinked
+}
+
+// VerifyIDToken checks the ID token's signature against the provider's JWKS and validates
+// the issuer, audience, expiry and nonce (OpenID Connect Core §3.1.3.7).
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, errors.New("invalid ID token: unexpected authorized party")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+
+	groups, err := readGroups(rawIDToken, p.config.GroupsClaim)
+	if err != nil {
+		return nil, err
+	}
+	claims.Groups = groups
+
+	return claims, nil
+}
+
+// readGroups extracts the groups claim from an already verified token. Providers send it
+// either as an array of strings or as a single space or comma separated string.
+func readGroups(rawIDToken, claim string) ([]string, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid ID token: malformed")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(payload, &all); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	var groups []string
+	switch value := all[claim].(type) {
+	case []any:
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	case string:
+		groups = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return groups, nil
+}
+
+// flexibleBool accepts both true and "true"; some providers send email_verified as a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(strings.EqualFold(v, "true"))
+	default:
+		*b = false
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the relying-party settings, loaded from the environment by ConfigFromEnv.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string   // Claim of the ID token that lists the user's groups
+	AdminGroups  []string // Members of any of these groups get the ADMIN role
+}
+
+// ConfigFromEnv reads OIDC_ISSUER_URL, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL,
+// OIDC_SCOPES, OIDC_GROUPS_CLAIM and OIDC_ADMIN_GROUPS.
+func ConfigFromEnv() Config {
+	config := Config{
+		IssuerURL:    strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	for _, group := range strings.Split(os.Getenv("OIDC_ADMIN_GROUPS"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			config.AdminGroups = append(config.AdminGroups, group)
+		}
+	}
+	return config
+}
+
+// Enabled reports whether enough configuration is present to use OIDC login.
+func (c Config) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != "" && c.RedirectURL != ""
+}
+
+// MapsRoles reports whether roles are managed by the identity provider (OIDC_ADMIN_GROUPS is set).
+func (c Config) MapsRoles() bool {
+	return len(c.AdminGroups) > 0
+}
+
+// IsAdmin reports whether any of the groups is one of the admin groups.
+func (c Config) IsAdmin(groups []string) bool {
+	for _, group := range groups {
+		if slices.Contains(c.AdminGroups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveryDocument is the subset of the provider metadata we use.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect relying party for one identity provider.
+type Provider struct {
+	config    Config
+	discovery discoveryDocument
+	keys      *keySet
+	http      *http.Client
+}
+
+var (
+	defaultProviderMu sync.Mutex
+	defaultProvider   *Provider
+)
+
+// Default returns the provider configured by the environment. Discovery runs on first
+// use and is retried on the next call if the identity provider was unreachable.
+func Default(ctx context.Context) (*Provider, error) {
+	defaultProviderMu.Lock()
+	defer defaultProviderMu.Unlock()
+
+	if defaultProvider != nil {
+		return defaultProvider, nil
+	}
+
+	config := ConfigFromEnv()
+	if !config.Enabled() {
+		return nil, errors.New("OIDC login is not configured")
+	}
+
+	provider, err := NewProvider(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defaultProvider = provider
+	return provider, nil
+}
+
+// NewProvider fetches the provider's discovery document and returns a ready-to-use Provider.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	var discovery discoveryDocument
+	if err := getJSON(ctx, httpClient, config.IssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	// The issuer must be exactly the one we were configured with (OpenID Connect Discovery §4.3)
+	if strings.TrimSuffix(discovery.Issuer, "/") != config.IssuerURL {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", discovery.Issuer, config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+
+	return &Provider{
+		config:    config,
+		discovery: discovery,
+		keys:      newKeySet(discovery.JWKSURI, httpClient),
+		http:      httpClient,
+	}, nil
+}
+
+// Config returns the configuration the provider was created with.
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+// AuthCodeURL returns the URL to send the browser to, for the authorization code flow with PKCE (S256).
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.config.ClientSecret == "" {
+		// Public clients identify themselves in the body
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
@@ -0,0 +1,321 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "magicstream"
+	testKeyID    = "test-key"
+)
+
+// mockProvider is a minimal OpenID Connect provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier of the code it issued.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// clientSecret, when set, must be sent with HTTP basic authentication
+	clientSecret string
+	// issuer is the issuer put in the discovery document; empty means the server URL
+	issuer string
+
+	mu sync.Mutex
+	// challenges maps the codes handed out to their PKCE code challenge
+	challenges map[string]string
+	// claims are put in the next ID token
+	claims jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, challenges: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) config() Config {
+	return Config{
+		IssuerURL:    m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: m.clientSecret,
+		RedirectURL:  "https://magicstream.test/auth/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+		GroupsClaim:  "groups",
+	}
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := m.issuer
+	if issuer == "" {
+		issuer = m.server.URL
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": m.server.URL + "/authorize",
+		"token_endpoint":         m.server.URL + "/token",
+		"jwks_uri":               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": testKeyID,
+		"use": "sig",
+		"n":   encode(m.key.N.Bytes()),
+		"e":   encode(big.NewInt(int64(m.key.E)).Bytes()),
+	}}})
+}
+
+// authorize plays the browser's round trip to the authorization endpoint and returns the code.
+func (m *mockProvider) authorize(authURL string) string {
+	m.t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+		m.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + query.Get("state")
+	m.challenges[code] = query.Get("code_challenge")
+	return code
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, secret, basic := r.BasicAuth()
+	switch {
+	case m.clientSecret != "":
+		if !basic || user != testClientID || secret != m.clientSecret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+	case r.PostForm.Get("client_id") != testClientID:
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	m.mu.Lock()
+	challenge, ok := m.challenges[r.PostForm.Get("code")]
+	delete(m.challenges, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     m.sign(m.claims),
+	})
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims) string {
+	m.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed
+}
+
+// validClaims are the claims of a good ID token for the given nonce.
+func (m *mockProvider) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@Example.com",
+		"email_verified": "true",
+		"groups":         []string{"staff", "movie-admins"},
+		"amr":            []string{"pwd", "mfa"},
+	}
+}
+
+// login runs the authorization code flow and returns the verified claims.
+func (m *mockProvider) login(provider *Provider, claims func(nonce string) jwt.MapClaims) (*IDTokenClaims, error) {
+	m.t.Helper()
+	ctx := context.Background()
+	state, _ := RandomString(32)
+	nonce, _ := RandomString(32)
+	codeVerifier, _ := RandomString(32)
+
+	code := m.authorize(provider.AuthCodeURL(state, nonce, codeVerifier))
+	m.claims = claims(nonce)
+	rawIDToken, err := provider.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		m.t.Fatalf("code exchange failed: %v", err)
+	}
+	return provider.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+func TestLoginFlow(t *testing.T) {
+	for _, clientSecret := range []string{"", "s3cret"} {
+		m := newMockProvider(t)
+		m.clientSecret = clientSecret
+		provider, err := NewProvider(context.Background(), m.config())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := m.login(provider, m.validClaims)
+		if err != nil {
+			t.Fatalf("client secret %q: %v", clientSecret, err)
+		}
+		if claims.Subject != "user-1" || claims.Email != "Ada@Example.com" || !bool(claims.EmailVerified) {
+			t.Errorf("unexpected claims: %+v", claims)
+		}
+		if !claims.MultiFactor() {
+			t.Error("amr with mfa should count as multi-factor")
+		}
+		if len(claims.Groups) != 2 || claims.Groups[1] != "movie-admins" {
+			t.Errorf("groups = %v", claims.Groups)
+		}
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	provider, err := NewProvider(context.Background(), m.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := m.authorize(provider.AuthCodeURL("state", "nonce", "the-verifier-sent-to-authorize-aaaaaaaaaaaa"))
+	m.claims = m.validClaims("nonce")
+	if _, err := provider.Exchange(context.Background(), code, "another-verifier-aaaaaaaaaaaaaaaaaaaaaaaaa"); err == nil {
+		t.Fatal("exchange with the wrong code verifier should fail")
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	m.issuer = "https://evil.example.com"
+	if _, err := NewProvider(context.Background(), m.config()); err == nil {
+		t.Fatal("discovery with another issuer should fail")
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	m := newMockProvider(t)
+	provider, err := NewProvider(context.Background(), m.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(claims jwt.MapClaims)
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * idTokenLeeway).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"nonce mismatch", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"unauthorized party", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := m.login(provider, func(nonce string) jwt.MapClaims {
+				claims := m.validClaims(nonce)
+				test.mutate(claims)
+				return claims
+			})
+			if err == nil {
+				t.Fatal("token should be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsSymmetricSignatures(t *testing.T) {
+	m := newMockProvider(t)
+	provider, err := NewProvider(context.Background(), m.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, m.validClaims("nonce"))
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString([]byte(testClientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(context.Background(), signed, "nonce"); err == nil {
+		t.Fatal("HS256 token should be rejected")
+	}
+
+	unsigned := strings.Join(strings.Split(m.sign(m.validClaims("nonce")), ".")[:2], ".") + "."
+	if _, err := provider.VerifyIDToken(context.Background(), unsigned, "nonce"); err == nil {
+		t.Fatal("unsigned token should be rejected")
+	}
+}
+
+func TestCanLinkAccount(t *testing.T) {
+	tests := []struct {
+		name                 string
+		providerVerified     bool
+		accountEmailVerified bool
+		accountLinked        bool
+		want                 bool
+	}{
+		{"both verified", true, true, false, true},
+		{"provider did not verify", false, true, false, false},
+		{"account never verified (pre-hijacking)", true, false, false, false},
+		{"neither verified", false, false, false, false},
+		{"already linked", true, true, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := &IDTokenClaims{EmailVerified: flexibleBool(test.providerVerified)}
+			if got := claims.CanLinkAccount(test.accountEmailVerified, test.accountLinked); got != test.want {
+				t.Errorf("CanLinkAccount = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
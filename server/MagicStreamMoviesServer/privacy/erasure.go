@@ -0,0 +1,136 @@
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Erase deletes or anonymizes the user's data in every registered source and records
+// what was done in the erasure_reports collection.
+//
+// Sources are processed in reverse registration order, so the user document goes last.
+// After each step the documents still matching the user are counted again; the report
+// is only marked verified when nothing is left outside of retained sources.
+// The report is returned even when the erasure fails, with the error in it. The tracker
+// counts the sources processed.
+func Erase(ctx context.Context, user *models.User, requestedBy, reason string, tracker *jobs.Tracker, client *mongo.Client) (*models.ErasureReport, error) {
+	reports := database.OpenCollection("erasure_reports", client)
+
+	report := &models.ErasureReport{
+		ReportID:    bson.NewObjectID().Hex(),
+		JobID:       tracker.JobID(),
+		UserID:      user.UserID,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		Status:      models.ErasureRunning,
+		Steps:       []models.ErasureStep{},
+		StartedAt:   time.Now(),
+	}
+	if _, err := reports.InsertOne(ctx, report); err != nil {
+		return nil, err
+	}
+
+	eraseErr := runErasure(ctx, user, report, tracker, client)
+
+	now := time.Now()
+	report.CompletedAt = &now
+	report.Status = models.ErasureCompleted
+	if eraseErr != nil {
+		report.Status = models.ErasureFailed
+		report.Error = eraseErr.Error()
+	}
+
+	update := bson.M{"$set": bson.M{
+		"status":       report.Status,
+		"steps":        report.Steps,
+		"verified":     report.Verified,
+		"error":        report.Error,
+		"completed_at": report.CompletedAt,
+	}}
+	if _, err := reports.UpdateOne(ctx, bson.M{"report_id": report.ReportID}, update); err != nil && eraseErr == nil {
+		eraseErr = err
+	}
+
+	return report, eraseErr
+}
+
+func runErasure(ctx context.Context, user *models.User, report *models.ErasureReport, tracker *jobs.Tracker, client *mongo.Client) error {
+	sources := Sources()
+	if err := tracker.SetTotal(ctx, int64(len(sources))); err != nil {
+		return err
+	}
+
+	for i := len(sources) - 1; i >= 0; i-- {
+		source := sources[i]
+		collection := database.OpenCollection(source.Collection, client)
+		filter := source.Filter(user)
+
+		step := models.ErasureStep{Collection: source.Collection, Action: source.Erase}
+
+		matched, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.Collection, err)
+		}
+		step.Matched = matched
+
+		switch source.Erase {
+		case models.ErasureActionDelete:
+			result, err := collection.DeleteMany(ctx, filter)
+			if err != nil {
+				return fmt.Errorf("%s: %w", source.Collection, err)
+			}
+			step.Affected = result.DeletedCount
+
+		case models.ErasureActionAnonymize:
+			result, err := collection.UpdateMany(ctx, filter, source.Anonymize(user))
+			if err != nil {
+				return fmt.Errorf("%s: %w", source.Collection, err)
+			}
+			step.Affected = result.ModifiedCount
+
+		case models.ErasureActionRetain:
+
+		default:
+			return fmt.Errorf("%s: unknown erasure action %q", source.Collection, source.Erase)
+		}
+
+		remaining, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.Collection, err)
+		}
+		step.Remaining = remaining
+		report.Steps = append(report.Steps, step)
+
+		// Stop before the user document is gone, so the erasure can be run again
+		if source.Erase != models.ErasureActionRetain && remaining > 0 {
+			return fmt.Errorf("%s: %d documents remain after erasure", source.Collection, remaining)
+		}
+		if source.Erase == models.ErasureActionRetain {
+			err = tracker.Skipped(ctx)
+		} else {
+			err = tracker.Succeeded(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	report.Verified = true
+	return nil
+}
+
+// FindErasureReport loads an erasure report.
+func FindErasureReport(ctx context.Context, reportID string, client *mongo.Client) (*models.ErasureReport, error) {
+	var report models.ErasureReport
+	if err := database.OpenCollection("erasure_reports", client).FindOne(ctx, bson.M{"report_id": reportID}).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,136 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// exportManifest is written as manifest.json at the root of the archive.
+type exportManifest struct {
+	UserID      string    `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+	Format      string    `json:"format"`
+}
+
+// sessionExport describes one of the user's web sessions without revealing its tokens.
+type sessionExport struct {
+	ID        string     `json:"id"`
+	Active    bool       `json:"active"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MFA       bool       `json:"mfa"`
+}
+
+// WriteExport writes a ZIP archive with one JSON file per registered source, the user's
+// session and a manifest. Documents are written as relaxed MongoDB Extended JSON.
+func WriteExport(ctx context.Context, w io.Writer, user *models.User, client *mongo.Client) error {
+	archive := zip.NewWriter(w)
+	manifest := exportManifest{
+		UserID:      user.UserID,
+		GeneratedAt: time.Now().UTC(),
+		Format:      "MongoDB relaxed Extended JSON",
+	}
+
+	for _, source := range Sources() {
+		if source.ExportName == "" {
+			continue
+		}
+		name := source.ExportName + ".json"
+		if err := exportSource(ctx, archive, name, source, user, client); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	if err := writeJSON(archive, "sessions.json", exportSessions(user)); err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, "sessions.json")
+
+	if err := writeJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func exportSource(ctx context.Context, archive *zip.Writer, name string, source Source, user *models.User, client *mongo.Client) error {
+	projection := bson.M{}
+	for _, field := range source.ExcludeFields {
+		projection[field] = 0
+	}
+
+	cursor, err := database.OpenCollection(source.Collection, client).Find(ctx, source.Filter(user), options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(file, "["); err != nil {
+		return err
+	}
+	for first := true; cursor.Next(ctx); first = false {
+		if !first {
+			if _, err := io.WriteString(file, ","); err != nil {
+				return err
+			}
+		}
+		doc, err := bson.MarshalExtJSONIndent(cursor.Current, false, false, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, "\n  "); err != nil {
+			return err
+		}
+		if _, err := file.Write(doc); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, "\n]\n")
+	return err
+}
+
+// exportSessions reports the sessions stored on the user document, one per signed-in
+// device. The token hashes are never exported.
+func exportSessions(user *models.User) []sessionExport {
+	sessions := []sessionExport{}
+	now := time.Now()
+	for _, session := range user.Sessions {
+		issuedAt, expiresAt := session.CreatedAt, session.ExpiresAt
+		sessions = append(sessions, sessionExport{
+			ID:        session.SessionID,
+			Active:    expiresAt.After(now),
+			IssuedAt:  &issuedAt,
+			ExpiresAt: &expiresAt,
+			MFA:       session.MFA,
+		})
+	}
+	return sessions
+}
+
+func writeJSON(archive *zip.Writer, name string, value any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,48 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/jobs"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const jobTimeout = 30 * time.Minute
+
+// StartErasure erases the user in a background job and returns it. The job's result
+// points to the erasure report, and the erasure is audited under auditAction once the
+// report is verified. A failed or interrupted erasure leaves the user document in place,
+// so it is resumed by starting it again. It fails with jobs.ErrRunning while the user
+// is already being erased.
+func StartErasure(user *models.User, requestedBy, reason, auditAction string, client *mongo.Client) (*models.Job, error) {
+	params := bson.M{"user_id": user.UserID, "reason": reason}
+	return jobs.StartFor(models.JobTypeErasure, user.UserID, params, requestedBy, jobTimeout, client, func(ctx context.Context, tracker *jobs.Tracker) error {
+		report, eraseErr := Erase(ctx, user, requestedBy, reason, tracker, client)
+		if report == nil {
+			return eraseErr
+		}
+
+		result := bson.M{"report_id": report.ReportID, "verified": report.Verified}
+		if err := tracker.SetResult(ctx, result); err != nil && eraseErr == nil {
+			eraseErr = err
+		}
+		if eraseErr != nil {
+			return eraseErr
+		}
+		if !report.Verified {
+			return errors.New("erasure could not be verified")
+		}
+
+		details := bson.M{"report_id": report.ReportID, "job_id": tracker.JobID(), "reason": reason}
+		if err := utils.RecordAudit(requestedBy, auditAction, user.UserID, details, client, ctx); err != nil {
+			log.Println("Failed to write audit log:", err)
+		}
+		return nil
+	})
+}
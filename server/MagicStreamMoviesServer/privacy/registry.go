@@ -0,0 +1,52 @@
+package privacy
+
+import (
+	"sync"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Source describes where personal data of a user is stored, and what happens to it
+// on export and erasure. Every collection holding per-user data must be registered,
+// so that data subject requests cover it.
+type Source struct {
+	Collection string
+	// Filter selects the user's documents.
+	Filter func(user *models.User) bson.M
+	// ExportName is the file name in the export archive (without extension).
+	// Empty leaves the source out of exports, e.g. for collections that only hold secrets.
+	ExportName string
+	// ExcludeFields are left out of the export (hashes, secrets, internal IDs).
+	ExcludeFields []string
+	// Erase is one of models.ErasureActionDelete, ErasureActionAnonymize or ErasureActionRetain.
+	Erase string
+	// Anonymize returns the update applied with ErasureActionAnonymize. It must make
+	// the documents stop matching Filter, which is how the erasure is verified.
+	Anonymize func(user *models.User) bson.M
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Source
+)
+
+// Register adds a source of personal data. The users collection is registered first
+// and, since sources are erased in reverse order, its document is deleted last: an
+// erasure that fails half way can simply be run again.
+func Register(source Source) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, source)
+}
+
+// Sources returns the registered sources, in registration order.
+func Sources() []Source {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Source(nil), registry...)
+}
+
+func byUserID(user *models.User) bson.M {
+	return bson.M{"user_id": user.UserID}
+}
@@ -0,0 +1,109 @@
+package privacy
+
+import (
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The collections holding personal data. New per-user collections are added here.
+func init() {
+	Register(Source{
+		Collection: "users",
+		Filter:     byUserID,
+		ExportName: "user",
+		ExcludeFields: []string{
+			"_id", "password", "sessions",
+			"totp_secret", "totp_pending_secret", "totp_last_step", "recovery_codes",
+		},
+		Erase: models.ErasureActionDelete,
+	})
+	Register(Source{
+		Collection:    "api_keys",
+		Filter:        byUserID,
+		ExportName:    "api_keys",
+		ExcludeFields: []string{"_id", "key_hash"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		// Only hashes of password reset and verification tokens: nothing to export
+		Collection: "one_time_tokens",
+		Filter:     byUserID,
+		Erase:      models.ErasureActionDelete,
+	})
+	Register(Source{
+		Collection: "login_attempts",
+		Filter: func(user *models.User) bson.M {
+			return bson.M{"key": utils.AccountAttemptKey(user.Email)}
+		},
+		ExportName:    "login_attempts",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		Collection:    "watch_events",
+		Filter:        byUserID,
+		ExportName:    "watch_history",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		Collection:    "user_lists",
+		Filter:        byUserID,
+		ExportName:    "lists",
+		ExcludeFields: []string{"_id", "share_token_hash"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		// Ratings stay, without their text and under a random ID, so that the
+		// aggregated rating of each movie keeps matching its reviews
+		Collection:    "reviews",
+		Filter:        byUserID,
+		ExportName:    "reviews",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionAnonymize,
+		Anonymize: func(user *models.User) bson.M {
+			return bson.M{
+				"$set":   bson.M{"user_id": "erased:" + bson.NewObjectID().Hex()},
+				"$unset": bson.M{"text": ""},
+			}
+		},
+	})
+	Register(Source{
+		// Derived from the collections above, recomputed by the recommendation job
+		Collection:    "recommendations",
+		Filter:        byUserID,
+		ExportName:    "recommendations",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		// Experiment results stay, under one random ID per erased user so that users are still counted
+		Collection:    "recommendation_impressions",
+		Filter:        byUserID,
+		ExportName:    "recommendation_impressions",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionAnonymize,
+		Anonymize: func(user *models.User) bson.M {
+			return bson.M{"$set": bson.M{"user_id": "erased:" + bson.NewObjectID().Hex()}}
+		},
+	})
+	Register(Source{
+		Collection:    "moderation_queue",
+		Filter:        byUserID,
+		ExportName:    "moderation",
+		ExcludeFields: []string{"_id", "decided_by"},
+		Erase:         models.ErasureActionDelete,
+	})
+	Register(Source{
+		// Kept as the security record of what was done to and by the account.
+		// Entries only hold user IDs, which mean nothing once the user document is gone.
+		Collection: "audit_logs",
+		Filter: func(user *models.User) bson.M {
+			return bson.M{"$or": bson.A{bson.M{"actor_id": user.UserID}, bson.M{"target_id": user.UserID}}}
+		},
+		ExportName:    "audit_logs",
+		ExcludeFields: []string{"_id"},
+		Erase:         models.ErasureActionRetain,
+	})
+}
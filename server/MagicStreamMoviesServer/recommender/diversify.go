@@ -0,0 +1,62 @@
+package recommender
+
+import (
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// DefaultDiversity is the lambda used by Diversify for served recommendations:
+// 1 keeps the relevance order, 0 only looks at how different the movies are.
+const DefaultDiversity = 0.7
+
+// Candidate is a movie that may be recommended.
+type Candidate struct {
+	Movie     models.Movie
+	Relevance float64 // Between 0 and 1
+	Reason    string
+}
+
+// Diversify picks k candidates with maximal marginal relevance (MMR): each step takes the
+// candidate maximising lambda × relevance − (1 − lambda) × its highest genre similarity to
+// the candidates already picked, so that one genre cannot fill the whole list.
+func Diversify(candidates []Candidate, k int, lambda float64) []Candidate {
+	remaining := append([]Candidate(nil), candidates...)
+	selected := make([]Candidate, 0, min(k, len(remaining)))
+
+	for len(selected) < k && len(remaining) > 0 {
+		best, bestScore := 0, 0.0
+		for i, candidate := range remaining {
+			redundancy := 0.0
+			for _, picked := range selected {
+				redundancy = max(redundancy, GenreSimilarity(&candidate.Movie, &picked.Movie))
+			}
+			score := lambda*candidate.Relevance - (1-lambda)*redundancy
+			if i == 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		selected = append(selected, remaining[best])
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return selected
+}
+
+// GenreSimilarity is the Jaccard similarity of the genres of two movies.
+func GenreSimilarity(a, b *models.Movie) float64 {
+	union := make(map[string]bool, len(a.Genre)+len(b.Genre))
+	inA := make(map[string]bool, len(a.Genre))
+	for _, genre := range a.Genre {
+		inA[genre.GenreName] = true
+		union[genre.GenreName] = true
+	}
+	shared := map[string]bool{}
+	for _, genre := range b.Genre {
+		union[genre.GenreName] = true
+		if inA[genre.GenreName] {
+			shared[genre.GenreName] = true
+		}
+	}
+	if len(union) == 0 {
+		return 0
+	}
+	return float64(len(shared)) / float64(len(union))
+}
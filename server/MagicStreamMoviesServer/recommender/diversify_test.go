@@ -0,0 +1,55 @@
+package recommender
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+func candidate(imdbID string, relevance float64, genres ...string) Candidate {
+	movie := models.Movie{ImdbID: imdbID}
+	for _, genre := range genres {
+		movie.Genre = append(movie.Genre, models.Genre{GenreName: genre})
+	}
+	return Candidate{Movie: movie, Relevance: relevance}
+}
+
+func TestDiversify(t *testing.T) {
+	candidates := []Candidate{
+		candidate("drama1", 0.9, "Drama"),
+		candidate("drama2", 0.85, "Drama"),
+		candidate("drama3", 0.8, "Drama", "Crime"),
+		candidate("comedy", 0.6, "Comedy"),
+	}
+
+	tests := []struct {
+		name   string
+		k      int
+		lambda float64
+		want   []string
+	}{
+		{"relevance only", 3, 1, []string{"drama1", "drama2", "drama3"}},
+		{"genres spread", 2, DefaultDiversity, []string{"drama1", "comedy"}},
+		{"partly shared genres first", 3, DefaultDiversity, []string{"drama1", "comedy", "drama3"}},
+		{"difference only", 2, 0, []string{"drama1", "comedy"}},
+		{"more than the candidates", 10, DefaultDiversity, []string{"drama1", "comedy", "drama3", "drama2"}},
+		{"none", 0, DefaultDiversity, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := Diversify(candidates, test.k, test.lambda)
+			got := make([]string, 0, len(selected))
+			for _, candidate := range selected {
+				got = append(got, candidate.Movie.ImdbID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Diversify = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if candidates[1].Movie.ImdbID != "drama2" {
+		t.Errorf("Diversify reordered its input: %v", candidates)
+	}
+}
@@ -0,0 +1,120 @@
+package recommender
+
+import (
+	"context"
+	"log"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Implicit preferences, used when the user did not rate the movie.
+const (
+	finishedPreference = 1.0 // Watched to the end
+	startedPreference  = 0.8 // Times the share watched, for viewings that were not finished
+	listedPreference   = 0.5 // In the watchlist or another list
+)
+
+// ratingPreference maps a 1-10 rating to a preference between -1 and 1.
+// Ratings override implicit signals: finishing a movie and rating it 2 is a dislike.
+func ratingPreference(rating int) float64 {
+	return (float64(rating) - 5.5) / 4.5
+}
+
+// LoadPreferences reads the interactions of every user: watch progress, list items and ratings.
+func LoadPreferences(ctx context.Context, client *mongo.Client) (Preferences, error) {
+	prefs := Preferences{}
+	set := func(userID, imdbID string, preference float64, override bool) {
+		items := prefs[userID]
+		if items == nil {
+			items = map[string]float64{}
+			prefs[userID] = items
+		}
+		if current, ok := items[imdbID]; override || !ok || preference > current {
+			items[imdbID] = preference
+		}
+	}
+
+	// Watch progress, one row per user and movie
+	watchPipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"user_id": "$user_id", "imdb_id": "$imdb_id"},
+			"progress": bson.M{"$max": "$progress"},
+			"finished": bson.M{"$max": "$finished"},
+		}}},
+	}
+	cursor, err := database.OpenCollection("watch_events", client).Aggregate(ctx, watchPipeline)
+	if err != nil {
+		return nil, err
+	}
+	err = each(ctx, cursor, func(row *struct {
+		ID struct {
+			UserID string `bson:"user_id"`
+			ImdbID string `bson:"imdb_id"`
+		} `bson:"_id"`
+		Progress float64 `bson:"progress"`
+		Finished bool    `bson:"finished"`
+	}) {
+		preference := startedPreference * row.Progress
+		if row.Finished {
+			preference = finishedPreference
+		}
+		set(row.ID.UserID, row.ID.ImdbID, preference, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// List items
+	listOpts := options.Find().SetProjection(bson.M{"_id": 0, "user_id": 1, "items.imdb_id": 1})
+	cursor, err = database.OpenCollection("user_lists", client).Find(ctx, bson.M{}, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	err = each(ctx, cursor, func(list *models.UserList) {
+		for _, item := range list.Items {
+			set(list.UserID, item.ImdbID, listedPreference, false)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ratings, including those of erased accounts: they still tell which movies go together
+	reviewOpts := options.Find().SetProjection(bson.M{"_id": 0, "user_id": 1, "imdb_id": 1, "rating": 1})
+	cursor, err = database.OpenCollection("reviews", client).Find(ctx, bson.M{}, reviewOpts)
+	if err != nil {
+		return nil, err
+	}
+	err = each(ctx, cursor, func(review *models.Review) {
+		set(review.UserID, review.ImdbID, ratingPreference(review.Rating), true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// each decodes the documents of a cursor one at a time, so that whole collections
+// are never held in memory as documents.
+func each[T any](ctx context.Context, cursor *mongo.Cursor, fn func(*T)) error {
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Println(err)
+		}
+	}(cursor, ctx)
+
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		fn(&doc)
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,184 @@
+package recommender
+
+import (
+	"math"
+	"sort"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+// Preferences holds, per user, how much they like each movie they interacted with,
+// between -1 (disliked) and 1.
+type Preferences map[string]map[string]float64
+
+// Neighbor is a movie similar to another one.
+type Neighbor struct {
+	ImdbID     string
+	Similarity float64
+}
+
+// Model is an item-item collaborative filtering model: the most similar movies of each movie.
+type Model struct {
+	Neighbors map[string][]Neighbor
+}
+
+// Params tunes the model.
+type Params struct {
+	// Neighbors is the number of similar movies kept per movie.
+	Neighbors int
+	// Shrinkage lowers the similarity of movies that few users have in common:
+	// similarities are multiplied by n / (n + Shrinkage) for n common users.
+	Shrinkage float64
+	// MaxItemsPerUser bounds the work done for very active users, whose strongest
+	// preferences are kept.
+	MaxItemsPerUser int
+}
+
+// DefaultParams are used by the recommendation job.
+var DefaultParams = Params{Neighbors: 50, Shrinkage: 10, MaxItemsPerUser: 500}
+
+type pairStats struct {
+	dot    float64
+	common int
+}
+
+// Train computes the cosine similarity between movies, seen as vectors of user preferences.
+// Only positive similarities are kept.
+func Train(prefs Preferences, params Params) *Model {
+	norms := map[string]float64{}
+	pairs := map[[2]string]*pairStats{}
+
+	for _, items := range prefs {
+		ids := strongest(items, params.MaxItemsPerUser)
+		for _, id := range ids {
+			norms[id] += items[id] * items[id]
+		}
+		for a := 0; a < len(ids); a++ {
+			for b := a + 1; b < len(ids); b++ {
+				key := pairKey(ids[a], ids[b])
+				stats := pairs[key]
+				if stats == nil {
+					stats = &pairStats{}
+					pairs[key] = stats
+				}
+				stats.dot += items[ids[a]] * items[ids[b]]
+				stats.common++
+			}
+		}
+	}
+
+	neighbors := map[string][]Neighbor{}
+	for key, stats := range pairs {
+		denominator := math.Sqrt(norms[key[0]]) * math.Sqrt(norms[key[1]])
+		if denominator == 0 || stats.dot <= 0 {
+			continue
+		}
+		similarity := stats.dot / denominator * float64(stats.common) / (float64(stats.common) + params.Shrinkage)
+		neighbors[key[0]] = append(neighbors[key[0]], Neighbor{ImdbID: key[1], Similarity: similarity})
+		neighbors[key[1]] = append(neighbors[key[1]], Neighbor{ImdbID: key[0], Similarity: similarity})
+	}
+
+	for id, list := range neighbors {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Similarity != list[j].Similarity {
+				return list[i].Similarity > list[j].Similarity
+			}
+			return list[i].ImdbID < list[j].ImdbID
+		})
+		if len(list) > params.Neighbors {
+			list = list[:params.Neighbors]
+		}
+		neighbors[id] = list
+	}
+
+	return &Model{Neighbors: neighbors}
+}
+
+// Recommend scores the movies similar to those the user interacted with, by the sum of
+// similarity times preference, and returns the best n with a positive score. Movies
+// the user already interacted with are left out.
+func (m *Model) Recommend(items map[string]float64, n int) []models.RecommendationItem {
+	scores := map[string]float64{}
+	contributions := map[string]map[string]float64{}
+
+	for seed, preference := range items {
+		for _, neighbor := range m.Neighbors[seed] {
+			if _, seen := items[neighbor.ImdbID]; seen {
+				continue
+			}
+			contribution := neighbor.Similarity * preference
+			scores[neighbor.ImdbID] += contribution
+			if contributions[neighbor.ImdbID] == nil {
+				contributions[neighbor.ImdbID] = map[string]float64{}
+			}
+			contributions[neighbor.ImdbID][seed] = contribution
+		}
+	}
+
+	recommendations := make([]models.RecommendationItem, 0, len(scores))
+	for id, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		recommendations = append(recommendations, models.RecommendationItem{
+			ImdbID:  id,
+			Score:   math.Round(score*1e4) / 1e4,
+			Because: topContributors(contributions[id], 2),
+		})
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].ImdbID < recommendations[j].ImdbID
+	})
+	if len(recommendations) > n {
+		recommendations = recommendations[:n]
+	}
+	return recommendations
+}
+
+// strongest returns the IDs of the preferences furthest from 0, at most limit, in a stable order.
+func strongest(items map[string]float64, limit int) []string {
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := math.Abs(items[ids[i]]), math.Abs(items[ids[j]])
+		if a != b {
+			return a > b
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+func topContributors(contributions map[string]float64, n int) []string {
+	ids := make([]string, 0, len(contributions))
+	for id, contribution := range contributions {
+		if contribution > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if contributions[ids[i]] != contributions[ids[j]] {
+			return contributions[ids[i]] > contributions[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+func pairKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
@@ -0,0 +1,92 @@
+package recommender
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/eichiarakaki/magic-stream/models"
+)
+
+func TestTrain(t *testing.T) {
+	twoFans := Preferences{"u1": {"a": 1, "b": 1}, "u2": {"a": 1, "b": 1}}
+
+	tests := []struct {
+		name   string
+		prefs  Preferences
+		params Params
+		want   map[string][]Neighbor
+	}{
+		{"cosine", twoFans, Params{Neighbors: 10, MaxItemsPerUser: 10},
+			map[string][]Neighbor{"a": {{"b", 1}}, "b": {{"a", 1}}}},
+		{"shrinkage for two common users", twoFans, Params{Neighbors: 10, Shrinkage: 10, MaxItemsPerUser: 10},
+			map[string][]Neighbor{"a": {{"b", 2.0 / 12}}, "b": {{"a", 2.0 / 12}}}},
+		{"opposite preferences", Preferences{"u1": {"a": 1, "b": -1}}, Params{Neighbors: 10, MaxItemsPerUser: 10},
+			map[string][]Neighbor{}},
+		{"most similar neighbors kept",
+			Preferences{"u1": {"a": 1, "b": 1, "c": 1}, "u2": {"a": 1, "b": 1}},
+			Params{Neighbors: 1, MaxItemsPerUser: 10},
+			map[string][]Neighbor{"a": {{"b", 1}}, "b": {{"a", 1}}, "c": {{"a", 1 / math.Sqrt2}}}},
+		{"strongest preferences per user",
+			Preferences{"u1": {"a": 1, "b": 0.5, "c": -1}},
+			Params{Neighbors: 10, MaxItemsPerUser: 2},
+			map[string][]Neighbor{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := Train(test.prefs, test.params)
+			if len(model.Neighbors) != len(test.want) {
+				t.Fatalf("Neighbors = %v, want %v", model.Neighbors, test.want)
+			}
+			for id, want := range test.want {
+				got := model.Neighbors[id]
+				if !slices.EqualFunc(got, want, func(a, b Neighbor) bool {
+					return a.ImdbID == b.ImdbID && math.Abs(a.Similarity-b.Similarity) < 1e-9
+				}) {
+					t.Errorf("Neighbors[%q] = %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestModelRecommend(t *testing.T) {
+	model := &Model{Neighbors: map[string][]Neighbor{
+		"a": {{"c", 0.8}, {"b", 0.5}},
+		"b": {{"d", 0.6}, {"c", 0.4}},
+		"e": {{"f", 0.9}},
+	}}
+
+	tests := []struct {
+		name  string
+		items map[string]float64
+		n     int
+		want  []models.RecommendationItem
+	}{
+		{"seen movies left out", map[string]float64{"a": 1, "b": 1}, 10, []models.RecommendationItem{
+			{ImdbID: "c", Score: 1.2, Because: []string{"a", "b"}},
+			{ImdbID: "d", Score: 0.6, Because: []string{"b"}},
+		}},
+		{"disliked neighbors dropped", map[string]float64{"a": 1, "e": -1}, 10, []models.RecommendationItem{
+			{ImdbID: "c", Score: 0.8, Because: []string{"a"}},
+			{ImdbID: "b", Score: 0.5, Because: []string{"a"}},
+		}},
+		{"only positive totals", map[string]float64{"a": -1, "b": 1}, 10, []models.RecommendationItem{
+			{ImdbID: "d", Score: 0.6, Because: []string{"b"}},
+		}},
+		{"best n", map[string]float64{"a": 1}, 1, []models.RecommendationItem{
+			{ImdbID: "c", Score: 0.8, Because: []string{"a"}},
+		}},
+		{"no neighbors", map[string]float64{"z": 1}, 10, []models.RecommendationItem{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := model.Recommend(test.items, test.n)
+			if !slices.EqualFunc(got, test.want, func(a, b models.RecommendationItem) bool {
+				return a.ImdbID == b.ImdbID && a.Score == b.Score && slices.Equal(a.Because, b.Because)
+			}) {
+				t.Errorf("Recommend = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package recommender computes personalised recommendations with item-item
+// collaborative filtering: movies are similar when the same users like them.
+package recommender
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/eichiarakaki/magic-stream/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// RecommendationsPerUser is the number of recommendations stored per user.
+	RecommendationsPerUser = 50
+
+	jobLease     = "recommendations"
+	jobLeaseTTL  = 30 * time.Minute
+	jobBatchSize = 500
+)
+
+// Stats describe a run of the recommendation job.
+type Stats struct {
+	Users    int           // Users with at least one interaction
+	Movies   int           // Movies with at least one similar movie
+	Written  int           // Users who got recommendations
+	Duration time.Duration // Time taken
+}
+
+// Run recomputes the recommendations of every user and replaces the recommendations
+// collection. Users without recommendations any more have theirs removed.
+func Run(ctx context.Context, client *mongo.Client) (Stats, error) {
+	start := time.Now()
+
+	prefs, err := LoadPreferences(ctx, client)
+	if err != nil {
+		return Stats{}, err
+	}
+	model := Train(prefs, DefaultParams)
+	stats := Stats{Users: len(prefs), Movies: len(model.Neighbors)}
+
+	collection := database.OpenCollection("recommendations", client)
+	batch := make([]mongo.WriteModel, 0, jobBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+
+	for userID, items := range prefs {
+		// Anonymized ratings of erased accounts help training but get nothing back
+		if strings.HasPrefix(userID, "erased:") {
+			continue
+		}
+		recommendations := model.Recommend(items, RecommendationsPerUser)
+		if len(recommendations) == 0 {
+			continue
+		}
+
+		batch = append(batch, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"user_id": userID}).
+			SetReplacement(models.UserRecommendations{
+				UserID:     userID,
+				Source:     models.RecommendationSourceItemCF,
+				Items:      recommendations,
+				ComputedAt: start,
+			}).
+			SetUpsert(true))
+		stats.Written++
+
+		if len(batch) == jobBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	if _, err := collection.DeleteMany(ctx, bson.M{"computed_at": bson.M{"$lt": start}}); err != nil {
+		return stats, err
+	}
+
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// Start runs the job now and then every RECOMMENDATION_JOB_INTERVAL (6h by default),
+// until ctx is cancelled. With several server instances, a lease makes sure only one
+// of them runs it at a time.
+func Start(ctx context.Context, client *mongo.Client) {
+	interval := utils.DurationFromEnv("RECOMMENDATION_JOB_INTERVAL", 6*time.Hour)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runOnce(ctx, interval, client)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runOnce runs the job unless another instance holds the lease. After a successful run
+// the lease is kept until shortly before the next tick, so that each interval sees one run
+// whatever the number of instances.
+func runOnce(parent context.Context, interval time.Duration, client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(parent, jobLeaseTTL)
+	defer cancel()
+
+	start := time.Now()
+	acquired, err := utils.AcquireLease(jobLease, utils.InstanceID, jobLeaseTTL, client, ctx)
+	if err != nil {
+		log.Println("Recommendation job: failed to acquire lease:", err)
+		return
+	}
+	if !acquired {
+		return // Ran or running on another instance
+	}
+
+	stats, err := Run(ctx, client)
+	if err != nil {
+		log.Println("Recommendation job failed:", err)
+		// Let another instance try at its next tick
+		if err := utils.ReleaseLease(jobLease, utils.InstanceID, client, context.Background()); err != nil {
+			log.Println("Recommendation job: failed to release lease:", err)
+		}
+		return
+	}
+	log.Printf("Recommendation job: %d users, %d movies with neighbours, %d users updated in %s",
+		stats.Users, stats.Movies, stats.Written, stats.Duration.Round(time.Millisecond))
+
+	if hold := interval - time.Since(start) - time.Minute; hold > 0 {
+		if _, err := utils.AcquireLease(jobLease, utils.InstanceID, hold, client, context.Background()); err != nil {
+			log.Println("Recommendation job: failed to extend lease:", err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// candidatesPerResult is how many candidates are gathered per requested result,
+// so that diversification has something to choose from.
+const candidatesPerResult = 4
+
+// Strategies of Recommend, compared by recommendation experiments.
+const (
+	// StrategyDiversified is the default: collaborative filtering, genre top-up and diversification.
+	StrategyDiversified = "diversified"
+	// StrategyRelevance is StrategyDiversified without diversification.
+	StrategyRelevance = "relevance"
+	// StrategyGenres only uses the best ranked movies of the genres, without diversification,
+	// like before collaborative filtering.
+	StrategyGenres = "genres"
+)
+
+// Strategies lists the valid values of Request.Strategy.
+var Strategies = []string{StrategyDiversified, StrategyRelevance, StrategyGenres}
+
+// Request describes the recommendations to serve.
+type Request struct {
+	UserID string
+	Limit  int
+	// Strategy is one of Strategies; empty means StrategyDiversified.
+	Strategy string
+	// Genres, when set, restricts recommendations to movies of these genres.
+	Genres []string
+	// FavoriteGenres of the user fill in when collaborative filtering has too little.
+	FavoriteGenres []string
+}
+
+// Recommend returns up to req.Limit movies the user has not watched yet, each with a reason.
+// Candidates come from the user's collaborative filtering results, then from the best ranked
+// movies of the requested (or favorite) genres, and are diversified with Diversify, as far as
+// req.Strategy uses each step.
+func Recommend(ctx context.Context, req Request, client *mongo.Client) ([]models.RecommendedMovie, error) {
+	exclude, err := watchedMovies(ctx, req.UserID, client)
+	if err != nil {
+		return nil, err
+	}
+	wanted := req.Limit * candidatesPerResult
+
+	var candidates []Candidate
+	if req.Strategy != StrategyGenres {
+		candidates, err = collaborativeCandidates(ctx, req, exclude, wanted, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, candidate := range candidates {
+		exclude = append(exclude, candidate.Movie.ImdbID)
+	}
+
+	genres, reasonFormat := req.FavoriteGenres, "Because you like %s"
+	if len(req.Genres) > 0 {
+		genres, reasonFormat = req.Genres, "Top ranked in %s"
+	}
+	if len(genres) > 0 && len(candidates) < wanted {
+		more, err := genreCandidates(ctx, genres, reasonFormat, exclude, wanted-len(candidates), client)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, more...)
+	}
+
+	lambda := DefaultDiversity
+	if req.Strategy == StrategyRelevance || req.Strategy == StrategyGenres {
+		lambda = 1
+	}
+	selected := Diversify(candidates, req.Limit, lambda)
+	movies := make([]models.RecommendedMovie, 0, len(selected))
+	for _, candidate := range selected {
+		movies = append(movies, models.RecommendedMovie{Movie: candidate.Movie, Reason: candidate.Reason})
+	}
+	return movies, nil
+}
+
+// collaborativeCandidates reads the user's precomputed recommendations. Relevance goes
+// from 0.5 to 1 with the score, so that they come before genre candidates.
+func collaborativeCandidates(ctx context.Context, req Request, exclude []string, limit int, client *mongo.Client) ([]Candidate, error) {
+	var recommendations models.UserRecommendations
+	err := database.OpenCollection("recommendations", client).FindOne(ctx, bson.M{"user_id": req.UserID}).Decode(&recommendations)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	imdbIDs := make([]string, 0, len(recommendations.Items))
+	var because []string
+	for _, item := range recommendations.Items {
+		imdbIDs = append(imdbIDs, item.ImdbID)
+		because = append(because, item.Because...)
+	}
+
+	filter := bson.M{"imdb_id": bson.M{"$in": imdbIDs, "$nin": exclude}}
+	if len(req.Genres) > 0 {
+		filter["genre.genre_name"] = bson.M{"$in": req.Genres}
+	}
+	movies, err := findMovies(ctx, filter, nil, client)
+	if err != nil {
+		return nil, err
+	}
+	titles, err := movieTitles(ctx, because, client)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Movie, len(movies))
+	for _, movie := range movies {
+		byID[movie.ImdbID] = movie
+	}
+	var best float64
+	if len(recommendations.Items) > 0 {
+		best = recommendations.Items[0].Score
+	}
+
+	candidates := make([]Candidate, 0, limit)
+	for _, item := range recommendations.Items {
+		movie, ok := byID[item.ImdbID]
+		if !ok {
+			continue // Watched since, filtered out or removed from the catalogue
+		}
+		relevance := 1.0
+		if best > 0 {
+			relevance = 0.5 + 0.5*item.Score/best
+		}
+		candidates = append(candidates, Candidate{Movie: movie, Relevance: relevance, Reason: becauseReason(item.Because, titles)})
+		if len(candidates) == limit {
+			break
+		}
+	}
+	return candidates, nil
+}
+
+// genreCandidates returns the best ranked movies of the genres. Relevance goes from 0.5
+// down to 0 with the rank. The reason names the first of the genres the movie has.
+func genreCandidates(ctx context.Context, genres []string, reasonFormat string, exclude []string, limit int, client *mongo.Client) ([]Candidate, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ranking.ranking_value", Value: 1}, {Key: "imdb_id", Value: 1}}).
+		SetLimit(int64(limit))
+	filter := bson.M{"genre.genre_name": bson.M{"$in": genres}, "imdb_id": bson.M{"$nin": exclude}}
+	movies, err := findMovies(ctx, filter, opts, client)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]Candidate, 0, len(movies))
+	for i, movie := range movies {
+		genre := genres[0]
+		for _, g := range genres {
+			if slices.ContainsFunc(movie.Genre, func(mg models.Genre) bool { return mg.GenreName == g }) {
+				genre = g
+				break
+			}
+		}
+		candidates = append(candidates, Candidate{
+			Movie:     movie,
+			Relevance: 0.5 * (1 - float64(i)/float64(len(movies))),
+			Reason:    fmt.Sprintf(reasonFormat, genre),
+		})
+	}
+	return candidates, nil
+}
+
+// becauseReason explains a collaborative filtering result with the user's movies behind it.
+func becauseReason(because []string, titles map[string]string) string {
+	var names []string
+	for _, imdbID := range because {
+		if title, ok := titles[imdbID]; ok {
+			names = append(names, title)
+		}
+	}
+	if len(names) == 0 {
+		return "Liked by people with similar taste"
+	}
+	return "Because you liked " + strings.Join(names, " and ")
+}
+
+// watchedMovies returns the IDs of the movies the user finished.
+func watchedMovies(ctx context.Context, userID string, client *mongo.Client) ([]string, error) {
+	values, err := database.OpenCollection("watch_events", client).Distinct(ctx, "imdb_id", bson.M{"user_id": userID, "finished": true}).Raw()
+	if err != nil {
+		return nil, err
+	}
+	elements, err := values.Values()
+	if err != nil {
+		return nil, err
+	}
+	imdbIDs := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if imdbID, ok := element.StringValueOK(); ok {
+			imdbIDs = append(imdbIDs, imdbID)
+		}
+	}
+	return imdbIDs, nil
+}
+
+func movieTitles(ctx context.Context, imdbIDs []string, client *mongo.Client) (map[string]string, error) {
+	titles := map[string]string{}
+	if len(imdbIDs) == 0 {
+		return titles, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"imdb_id": 1, "title": 1})
+	movies, err := findMovies(ctx, bson.M{"imdb_id": bson.M{"$in": imdbIDs}}, opts, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range movies {
+		titles[movie.ImdbID] = movie.Title
+	}
+	return titles, nil
+}
+
+func findMovies(ctx context.Context, filter bson.M, opts *options.FindOptionsBuilder, client *mongo.Client) ([]models.Movie, error) {
+	if opts == nil {
+		opts = options.Find()
+	}
+	cursor, err := database.OpenCollection("movies", client).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var movies []models.Movie
+	if err := cursor.All(ctx, &movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	controller "github.com/eichiarakaki/magic-stream/controllers"
+	"github.com/eichiarakaki/magic-stream/middleware"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// SetupAdminRoutes registers the /admin endpoints. It must be called after
+// SetupProtectedRoutes so that the authentication middleware applies to them.
+func SetupAdminRoutes(router *gin.Engine, client *mongo.Client) {
+	admin := router.Group("/admin", middleware.AdminOnly())
+
+	// User management is reserved to interactive admin sessions
+	users := admin.Group("/users", middleware.SessionOnly())
+	users.GET("", controller.ListUsers(client))
+	users.GET("/:user_id", controller.GetUser(client))
+	users.PATCH("/:user_id/role", controller.UpdateUserRole(client))
+	users.POST("/:user_id/disable", controller.DisableUser(client))
+	users.POST("/:user_id/enable", controller.EnableUser(client))
+	users.POST("/:user_id/logout", controller.ForceLogoutUser(client))
+	users.POST("/:user_id/unlock", controller.UnlockUser(client))
+	users.GET("/:user_id/export", controller.ExportUserData(client))
+	users.POST("/:user_id/erase", controller.EraseUser(client))
+
+	admin.GET("/erasure-reports/:report_id", middleware.SessionOnly(), controller.GetErasureReport(client))
+
+	admin.POST("/embeddings/rebuild", middleware.SessionOnly(), controller.RebuildEmbeddings(client))
+
+	moderation := admin.Group("/moderation", middleware.SessionOnly())
+	moderation.GET("", controller.ListModerationItems(client))
+	moderation.POST("/:item_id/approve", controller.ApproveModerationItem(client))
+	moderation.POST("/:item_id/reject", controller.RejectModerationItem(client))
+
+	admin.POST("/enrichment/run", middleware.SessionOnly(), controller.RunEnrichment(client))
+	admin.PATCH("/movies/:imdb_id/enrichment", middleware.SessionOnly(), controller.EditMovieEnrichment(client))
+
+	admin.POST("/import/movies", middleware.SessionOnly(), controller.ImportMovies(client))
+	admin.GET("/export/movies", middleware.SessionOnly(), controller.ExportMovies(client))
+
+	jobs := admin.Group("/jobs", middleware.SessionOnly())
+	jobs.GET("", controller.ListJobs(client))
+	jobs.GET("/:job_id", controller.GetJob(client))
+
+	experiments := admin.Group("/experiments", middleware.SessionOnly())
+	experiments.GET("", controller.ListExperiments(client))
+	experiments.POST("", controller.CreateExperiment(client))
+	experiments.GET("/:experiment_id", controller.GetExperiment(client))
+	experiments.POST("/:experiment_id/start", controller.StartExperiment(client))
+	experiments.POST("/:experiment_id/stop", controller.StopExperiment(client))
+	experiments.GET("/:experiment_id/report", controller.GetExperimentReport(client))
+}
@@ -3,16 +3,56 @@ package routes
 import (
 	controller "github.com/eichiarakaki/magic-stream/controllers"
 	"github.com/eichiarakaki/magic-stream/middleware"
+	"github.com/eichiarakaki/magic-stream/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func SetupProtectedRoutes(router *gin.Engine, client *mongo.Client) {
-	router.Use(middleware.AuthMiddleware())
+	router.Use(middleware.AuthMiddleware(client))
+	router.Use(middleware.CSRFMiddleware())
+	router.Use(middleware.EmailVerificationMiddleware())
 
-	router.GET("/movie/:imdb_id", controller.GetMovie(client))
-	router.POST("/add-movie", controller.AddMovie(client))
-	router.GET("/recommended-movies", controller.GetRecommendedMovies(client))
-	router.PATCH("/update-review/:imdb_id", controller.AdminReviewUpdate(client))
-	router.POST("/logout", controller.LogoutUser(client))
+	router.GET("/movie/:imdb_id", middleware.RequireScope(models.ScopeMoviesRead), controller.GetMovie(client))
+	router.GET("/movie/:imdb_id/similar", middleware.RequireScope(models.ScopeMoviesRead), controller.GetSimilarMovies(client))
+	router.POST("/discover", middleware.RequireScope(models.ScopeMoviesRead), controller.DiscoverMovies(client))
+	router.POST("/add-movie", middleware.RequireScope(models.ScopeMoviesWrite), middleware.AdminOnly(), controller.AddMovie(client))
+	router.GET("/recommended-movies", middleware.RequireScope(models.ScopeRecommendationsRead), controller.GetRecommendedMovies(client))
+	router.POST("/recommended-movies/:imdb_id/click", middleware.RequireScope(models.ScopeRecommendationsRead), controller.RecordRecommendationClick(client))
+	router.PATCH("/update-review/:imdb_id", middleware.RequireScope(models.ScopeReviewsWrite), middleware.AdminOnly(), controller.AdminReviewUpdate(client))
+	router.POST("/logout", middleware.SessionOnly(), controller.LogoutUser(client))
+
+	router.GET("/me", middleware.SessionOnly(), controller.GetProfile(client))
+	router.PATCH("/me", middleware.SessionOnly(), controller.UpdateProfile(client))
+	router.POST("/me/password", middleware.SessionOnly(), controller.ChangePassword(client))
+	router.DELETE("/me", middleware.SessionOnly(), controller.DeleteAccount(client))
+	router.GET("/me/export", middleware.SessionOnly(), controller.ExportMyData(client))
+	router.GET("/me/continue-watching", middleware.SessionOnly(), controller.GetContinueWatching(client))
+	router.GET("/me/history", middleware.SessionOnly(), controller.GetWatchHistory(client))
+	router.POST("/watch/progress", middleware.SessionOnly(), controller.RecordWatchProgress(client))
+
+	router.POST("/movie/:imdb_id/reviews", middleware.SessionOnly(), controller.CreateReview(client))
+	router.PATCH("/reviews/:review_id", middleware.SessionOnly(), controller.UpdateReview(client))
+	router.DELETE("/reviews/:review_id", middleware.SessionOnly(), controller.DeleteReview(client))
+	router.GET("/me/reviews", middleware.SessionOnly(), controller.GetMyReviews(client))
+
+	router.GET("/me/lists", middleware.SessionOnly(), controller.GetMyLists(client))
+	router.POST("/me/lists", middleware.SessionOnly(), controller.CreateList(client))
+	router.GET("/me/lists/:list_id", middleware.SessionOnly(), controller.GetMyList(client))
+	router.PATCH("/me/lists/:list_id", middleware.SessionOnly(), controller.UpdateList(client))
+	router.DELETE("/me/lists/:list_id", middleware.SessionOnly(), controller.DeleteList(client))
+	router.POST("/me/lists/:list_id/items", middleware.SessionOnly(), controller.AddListItem(client))
+	router.PUT("/me/lists/:list_id/items", middleware.SessionOnly(), controller.ReorderListItems(client))
+	router.DELETE("/me/lists/:list_id/items/:imdb_id", middleware.SessionOnly(), controller.RemoveListItem(client))
+	router.POST("/me/lists/:list_id/share", middleware.SessionOnly(), controller.ShareList(client))
+	router.DELETE("/me/lists/:list_id/share", middleware.SessionOnly(), controller.UnshareList(client))
+
+	router.GET("/api-keys", middleware.SessionOnly(), controller.ListAPIKeys(client))
+	router.POST("/api-keys", middleware.SessionOnly(), controller.CreateAPIKey(client))
+	router.DELETE("/api-keys/:key_id", middleware.SessionOnly(), controller.RevokeAPIKey(client))
+
+	router.POST("/mfa/totp/enroll", middleware.SessionOnly(), controller.EnrollTOTP(client))
+	router.POST("/mfa/totp/confirm", middleware.SessionOnly(), controller.ConfirmTOTP(client))
+	router.POST("/mfa/totp/disable", middleware.SessionOnly(), controller.DisableTOTP(client))
+	router.POST("/mfa/recovery-codes", middleware.SessionOnly(), controller.RegenerateRecoveryCodes(client))
 }
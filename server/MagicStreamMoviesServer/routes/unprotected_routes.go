@@ -11,6 +11,16 @@ func SetupUnProtectedRoutes(router *gin.Engine, client *mongo.Client) {
 	router.GET("/movies", controller.GetMovies(client))
 	router.POST("/register", controller.RegisterUser(client))
 	router.POST("/login", controller.LoginUser(client))
+	router.POST("/login/mfa", controller.LoginMFA(client))
 	router.POST("/refresh-token", controller.RefreshTokenHandler(client))
 	router.GET("/genres", controller.GetGenres(client))
+	router.POST("/password/forgot", controller.ForgotPassword(client))
+	router.POST("/password/reset", controller.ResetPassword(client))
+	router.POST("/verify-email", controller.VerifyEmail(client))
+	router.POST("/verify-email/resend", controller.ResendVerificationEmail(client))
+	router.GET("/auth/oidc/login", controller.OIDCLogin(client))
+	router.GET("/auth/oidc/callback", controller.OIDCCallback(client))
+	router.GET("/movie/:imdb_id/reviews", controller.GetMovieReviews(client))
+	router.GET("/lists/:list_id", controller.GetPublicList(client))
+	router.GET("/shared/lists/:share_token", controller.GetSharedList(client))
 }
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// APIKeyPrefix marks MagicStream API keys so they are easy to spot in logs and secret scanners.
+const APIKeyPrefix = "msk_"
+
+// apiKeyLastUsedResolution avoids a database write on every request made with the same key.
+const apiKeyLastUsedResolution = time.Minute
+
+// GenerateAPIKey returns a new random API key together with the hash that must be stored.
+func GenerateAPIKey() (key string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes an API key for storage and lookup.
+// Keys carry 256 bits of entropy, so a fast hash is enough (unlike passwords).
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIKey looks up the key presented by the caller, checks that it is neither
+// revoked nor expired and returns it together with its owner.
+// The key's last_used_at timestamp is refreshed at most once per minute.
+func AuthenticateAPIKey(rawKey string, client *mongo.Client, c *gin.Context) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) {
+		return nil, nil, errors.New("malformed API key")
+	}
+
+	var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	apiKeys := database.OpenCollection("api_keys", client)
+
+	var apiKey models.APIKey
+	err := apiKeys.FindOne(ctx, bson.M{"key_hash": HashAPIKey(rawKey)}).Decode(&apiKey)
+	if err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		return nil, nil, errors.New("API key has been revoked")
+	}
+	if now.After(apiKey.ExpiresAt) {
+		return nil, nil, errors.New("API key has expired")
+	}
+
+	var owner models.User
+	err = database.OpenCollection("users", client).FindOne(ctx, bson.M{"user_id": apiKey.UserID}).Decode(&owner)
+	if err != nil {
+		return nil, nil, errors.New("API key owner not found")
+	}
+	if owner.Disabled {
+		return nil, nil, errors.New("API key owner is disabled")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyLastUsedResolution {
+		_, err = apiKeys.UpdateOne(ctx, bson.M{"key_id": apiKey.KeyID}, bson.M{"$set": bson.M{"last_used_at": now}})
+		if err != nil {
+			// Not fatal, the request can still be served
+			log.Println("Warning: unable to update API key last use:", err)
+		}
+	}
+
+	return &apiKey, &owner, nil
+}
+
+// HasScope reports whether the API key was granted the given scope.
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+func GetAuthMethodFromContext(c *gin.Context) string {
+	method, exists := c.Get("auth_method")
+	if !exists {
+		return ""
+	}
+
+	return method.(string)
+}
+
+func GetAPIKeyScopesFromContext(c *gin.Context) []string {
+	scopes, exists := c.Get("api_key_scopes")
+	if !exists {
+		return nil
+	}
+
+	return scopes.([]string)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// RecordAudit appends an entry to the audit_logs collection.
+func RecordAudit(actorID, action, targetID string, details bson.M, client *mongo.Client, parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, 100*time.Second)
+	defer cancel()
+
+	_, err := database.OpenCollection("audit_logs", client).InsertOne(ctx, models.AuditLog{
+		AuditID:   bson.NewObjectID().Hex(),
+		ActorID:   actorID,
+		Action:    action,
+		TargetID:  targetID,
+		Details:   details,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
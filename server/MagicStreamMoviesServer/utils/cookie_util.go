@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Base cookie names, before the policy prefix is applied.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookieName     = "csrf_token"
+	OIDCStateCookie    = "oidc_state"
+)
+
+// CookiePolicy holds the attributes shared by every cookie the server sets.
+// It is the only place cookies are built, so login, refresh and logout always agree.
+//
+// Configuration (environment variables):
+//   - COOKIE_DOMAIN: cookie Domain attribute (default "localhost", ignored with the __Host- prefix)
+//   - COOKIE_SECURE: "true"/"false" (default true)
+//   - COOKIE_SAMESITE: "none", "lax" or "strict" (default "none")
+//   - COOKIE_PREFIX: "", "__Host-" or "__Secure-"
+type CookiePolicy struct {
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+	Prefix   string
+}
+
+var cookiePolicy = sync.OnceValue(loadCookiePolicy)
+
+// GetCookiePolicy returns the cookie policy loaded from the environment on first use.
+func GetCookiePolicy() CookiePolicy {
+	return cookiePolicy()
+}
+
+func loadCookiePolicy() CookiePolicy {
+	policy := CookiePolicy{
+		Domain:   "localhost",
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Prefix:   os.Getenv("COOKIE_PREFIX"),
+	}
+
+	if domain, ok := os.LookupEnv("COOKIE_DOMAIN"); ok {
+		policy.Domain = domain
+	}
+	if secure := os.Getenv("COOKIE_SECURE"); secure != "" {
+		value, err := strconv.ParseBool(secure)
+		if err != nil {
+			log.Println("Warning: invalid COOKIE_SECURE, using true")
+			value = true
+		}
+		policy.Secure = value
+	}
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "", "none":
+		policy.SameSite = http.SameSiteNoneMode
+	case "lax":
+		policy.SameSite = http.SameSiteLaxMode
+	case "strict":
+		policy.SameSite = http.SameSiteStrictMode
+	default:
+		log.Println("Warning: invalid COOKIE_SAMESITE, using none")
+	}
+
+	// Browsers reject cookies that break the rules below, so enforce them here
+	// instead of silently losing the session cookies.
+	switch policy.Prefix {
+	case "":
+	case "__Host-":
+		policy.Domain = ""
+		policy.Path = "/"
+		policy.Secure = true
+	case "__Secure-":
+		policy.Secure = true
+	default:
+		log.Printf("Warning: unsupported COOKIE_PREFIX %q, ignoring it", policy.Prefix)
+		policy.Prefix = ""
+	}
+	if policy.SameSite == http.SameSiteNoneMode && !policy.Secure {
+		log.Println("Warning: SameSite=None requires Secure cookies, forcing COOKIE_SECURE=true")
+		policy.Secure = true
+	}
+
+	return policy
+}
+
+// Name returns the full cookie name, including the configured prefix.
+func (p CookiePolicy) Name(base string) string {
+	return p.Prefix + base
+}
+
+// SetAuthCookies sets the access and refresh token cookies.
+// Their lifetimes match the token expiry so the browser never keeps a dead token.
+func (p CookiePolicy) SetAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	p.set(c, AccessTokenCookie, accessToken, AccessTokenTTL(), true)
+	p.set(c, RefreshTokenCookie, refreshToken, RefreshTokenTTL(), true)
+}
+
+// SetCSRFCookie sets the CSRF token cookie. It is readable by JavaScript and lives as long as the refresh token.
+func (p CookiePolicy) SetCSRFCookie(c *gin.Context, csrfToken string) {
+	p.set(c, CSRFCookieName, csrfToken, RefreshTokenTTL(), false)
+}
+
+// ClearAuthCookies expires every session cookie, using the same attributes they were set with.
+func (p CookiePolicy) ClearAuthCookies(c *gin.Context) {
+	p.set(c, AccessTokenCookie, "", -1, true)
+	p.set(c, RefreshTokenCookie, "", -1, true)
+	p.set(c, CSRFCookieName, "", -1, false)
+}
+
+// SetOIDCStateCookie stores the signed state of an OIDC login while the user is at the identity provider.
+// It is always SameSite=Lax: the provider sends the user back with a cross-site top-level
+// GET, which Lax allows, and the cookie is useless to any other request.
+func (p CookiePolicy) SetOIDCStateCookie(c *gin.Context, value string) {
+	p.setSameSite(c, OIDCStateCookie, value, OIDCStateTTL, true, http.SameSiteLaxMode)
+}
+
+// ClearOIDCStateCookie expires the OIDC state cookie once the callback has used it.
+func (p CookiePolicy) ClearOIDCStateCookie(c *gin.Context) {
+	p.setSameSite(c, OIDCStateCookie, "", -1, true, http.SameSiteLaxMode)
+}
+
+// Cookie reads a cookie set by this policy.
+func (p CookiePolicy) Cookie(c *gin.Context, base string) (string, error) {
+	return c.Cookie(p.Name(base))
+}
+
+func (p CookiePolicy) set(c *gin.Context, base, value string, ttl time.Duration, httpOnly bool) {
+	p.setSameSite(c, base, value, ttl, httpOnly, p.SameSite)
+}
+
+func (p CookiePolicy) setSameSite(c *gin.Context, base, value string, ttl time.Duration, httpOnly bool, sameSite http.SameSite) {
+	maxAge := -1 // expire immediately
+	if ttl > 0 {
+		maxAge = int(ttl.Seconds())
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     p.Name(base),
+		Value:    value,
+		Path:     p.Path,
+		Domain:   p.Domain,
+		MaxAge:   maxAge,
+		Secure:   p.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
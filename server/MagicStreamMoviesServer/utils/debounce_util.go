@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer lets through at most one event per key and interval. State is kept in
+// memory, so with several server instances each one debounces on its own.
+type Debouncer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewDebouncer(interval time.Duration) *Debouncer {
+	return &Debouncer{interval: interval, last: make(map[string]time.Time)}
+}
+
+// Allow reports whether an event for the key should go through now, and if so records it.
+func (d *Debouncer) Allow(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.last[key]; ok && now.Sub(last) < d.interval {
+		return false
+	}
+	d.last[key] = now
+
+	// Forget keys that are quiet anyway, so the map does not grow forever
+	if len(d.last) > 10000 {
+		for k, t := range d.last {
+			if now.Sub(t) >= d.interval {
+				delete(d.last, k)
+			}
+		}
+	}
+	return true
+}
+
+// Reset forgets the key, so its next event goes through.
+func (d *Debouncer) Reset(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.last, key)
+}
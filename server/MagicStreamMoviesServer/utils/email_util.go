@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Values of UNVERIFIED_ACCOUNT_POLICY, deciding what accounts with an unverified email can do.
+const (
+	UnverifiedAllow    = "allow"     // No restriction (default)
+	UnverifiedReadOnly = "read_only" // Can log in and read, but not create or change anything
+	UnverifiedBlock    = "block"     // Cannot log in until the email is verified
+)
+
+// NormalizeEmail trims and case-folds an email address so that lookups and
+// uniqueness checks do not depend on how the user typed it.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// GetUnverifiedAccountPolicy returns the configured UNVERIFIED_ACCOUNT_POLICY.
+func GetUnverifiedAccountPolicy() string {
+	policy := strings.ToLower(os.Getenv("UNVERIFIED_ACCOUNT_POLICY"))
+	switch policy {
+	case "":
+		return UnverifiedAllow
+	case UnverifiedAllow, UnverifiedReadOnly, UnverifiedBlock:
+		return policy
+	default:
+		log.Printf("Warning: unknown UNVERIFIED_ACCOUNT_POLICY %q, using %q", policy, UnverifiedAllow)
+		return UnverifiedAllow
+	}
+}
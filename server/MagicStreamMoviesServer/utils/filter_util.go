@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// FilterBuilder turns query parameters into a MongoDB filter. The first invalid
+// parameter is kept as the error returned by Build.
+type FilterBuilder struct {
+	values url.Values
+	filter bson.M
+	err    error
+}
+
+// NewFilterBuilder reads parameters from values, such as c.Request.URL.Query().
+func NewFilterBuilder(values url.Values) *FilterBuilder {
+	return &FilterBuilder{values: values, filter: bson.M{}}
+}
+
+// IntRange matches field between the integers of the min and max parameters, inclusive.
+// Values outside [lower, upper] are rejected.
+func (b *FilterBuilder) IntRange(field, minParam, maxParam string, lower, upper int) *FilterBuilder {
+	bounds := bson.M{}
+	for _, bound := range []struct{ operator, param string }{{"$gte", minParam}, {"$lte", maxParam}} {
+		operator, param := bound.operator, bound.param
+		raw := b.values.Get(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < lower || value > upper {
+			b.fail(fmt.Errorf("%s must be an integer between %d and %d", param, lower, upper))
+			continue
+		}
+		bounds[operator] = value
+	}
+	if len(bounds) > 0 {
+		b.filter[field] = bounds
+	}
+	return b
+}
+
+// AnyOf matches documents whose field (or any element of it, for arrays) is one of the
+// comma separated values of the parameter. With allowed set, other values are rejected;
+// values are then compared case-insensitively and replaced by their allowed spelling.
+func (b *FilterBuilder) AnyOf(field, param string, allowed []string) *FilterBuilder {
+	raw := b.values.Get(param)
+	if raw == "" {
+		return b
+	}
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if allowed != nil {
+			i := slices.IndexFunc(allowed, func(a string) bool { return strings.EqualFold(a, value) })
+			if i < 0 {
+				b.fail(fmt.Errorf("%s must be among %s", param, strings.Join(allowed, ", ")))
+				return b
+			}
+			value = allowed[i]
+		}
+		values = append(values, value)
+	}
+	if len(values) > 0 {
+		b.filter[field] = bson.M{"$in": values}
+	}
+	return b
+}
+
+// Languages matches documents whose field (or any element of it) is one of the comma
+// separated BCP 47 language tags of the parameter, compared in their canonical form.
+func (b *FilterBuilder) Languages(field, param string) *FilterBuilder {
+	raw := b.values.Get(param)
+	if raw == "" {
+		return b
+	}
+	var tags []string
+	for _, value := range strings.Split(raw, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		tag, err := CanonicalLanguageTag(value)
+		if err != nil {
+			b.fail(fmt.Errorf("%s: %w", param, err))
+			return b
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > 0 {
+		b.filter[field] = bson.M{"$in": tags}
+	}
+	return b
+}
+
+// Contains matches documents whose field (or any element of it) contains the parameter,
+// ignoring case.
+func (b *FilterBuilder) Contains(field, param string) *FilterBuilder {
+	value := strings.TrimSpace(b.values.Get(param))
+	if value == "" {
+		return b
+	}
+	if len(value) > 200 {
+		b.fail(fmt.Errorf("%s must be at most 200 characters", param))
+		return b
+	}
+	b.filter[field] = bson.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}
+	return b
+}
+
+// Build returns the filter, or the first invalid parameter.
+func (b *FilterBuilder) Build() (bson.M, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.filter, nil
+}
+
+func (b *FilterBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// MovieFilter builds the movie filter shared by the listing (GET /movies) and catalog
+// export endpoints:
+//   - genre: comma separated genre names, any of them
+//   - year_from, year_to: release year range
+//   - runtime_min, runtime_max: runtime range in minutes
+//   - age_rating: comma separated age ratings
+//   - language: comma separated language tags, any of them
+//   - cast, director: part of a name
+//   - title: part of the title
+func MovieFilter(values url.Values) (bson.M, error) {
+	return NewFilterBuilder(values).
+		AnyOf("genre.genre_name", "genre", nil).
+		IntRange("release_year", "year_from", "year_to", 1888, 2100).
+		IntRange("runtime_minutes", "runtime_min", "runtime_max", 1, 1000).
+		AnyOf("age_rating", "age_rating", models.AgeRatings).
+		Languages("languages", "language").
+		Contains("cast", "cast").
+		Contains("directors", "director").
+		Contains("title", "title").
+		Build()
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// InstanceID identifies this server process as the holder of a lease.
+var InstanceID = bson.NewObjectID().Hex()
+
+// AcquireLease takes the named lease in the job_locks collection for ttl, so that
+// background jobs run on one server instance at a time. It returns false while another
+// holder's lease has not expired. The holder may renew its own lease.
+func AcquireLease(name, holder string, ttl time.Duration, client *mongo.Client, ctx context.Context) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{bson.M{"expires_at": bson.M{"$lte": now}}, bson.M{"holder": holder}},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "acquired_at": now, "expires_at": now.Add(ttl)}}
+
+	_, err := database.OpenCollection("job_locks", client).UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil // The lease exists and is held by someone else
+	}
+	return err == nil, err
+}
+
+// ReleaseLease gives up a lease before it expires.
+func ReleaseLease(name, holder string, client *mongo.Client, ctx context.Context) error {
+	_, err := database.OpenCollection("job_locks", client).UpdateOne(ctx,
+		bson.M{"_id": name, "holder": holder},
+		bson.M{"$set": bson.M{"expires_at": time.Now()}},
+	)
+	return err
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// throttlePolicy describes when a login key gets locked.
+// After FreeAttempts failures, each further failure locks the key for
+// BaseLockout, doubling every time, up to MaxLockout.
+type throttlePolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+}
+
+var (
+	// Per account: protects a single account against password guessing
+	accountThrottle = throttlePolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour}
+	// Per IP: slows down credential stuffing across many accounts
+	ipThrottle = throttlePolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour}
+)
+
+// failureWindow is how long failures are remembered after the last one.
+const failureWindow = time.Hour
+
+type loginAttempts struct {
+	Key           string     `bson:"key"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty"`
+}
+
+// LoginAttemptKeys returns the throttling keys of a login attempt: the account and the client IP.
+func LoginAttemptKeys(email string, c *gin.Context) (accountKey, ipKey string) {
+	return AccountAttemptKey(email), "ip:" + c.ClientIP()
+}
+
+// AccountAttemptKey returns the throttling key of an account.
+func AccountAttemptKey(email string) string {
+	return "email:" + NormalizeEmail(email)
+}
+
+// GetLoginLockout returns how long the caller must wait before trying to log in again,
+// or zero if neither the account nor the IP is locked.
+func GetLoginLockout(accountKey, ipKey string, client *mongo.Client, c *gin.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	cursor, err := database.OpenCollection("login_attempts", client).Find(ctx, bson.M{
+		"key":          bson.M{"$in": bson.A{accountKey, ipKey}},
+		"locked_until": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var locked []loginAttempts
+	if err := cursor.All(ctx, &locked); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, attempts := range locked {
+		if remaining := time.Until(*attempts.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login for both the account and the IP,
+// locking them with exponential backoff once their free attempts are used up.
+func RecordLoginFailure(accountKey, ipKey string, client *mongo.Client, c *gin.Context) error {
+	return errors.Join(
+		recordFailure(accountKey, accountThrottle, client, c),
+		recordFailure(ipKey, ipThrottle, client, c),
+	)
+}
+
+func recordFailure(key string, policy throttlePolicy, client *mongo.Client, c *gin.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	attemptsCollection := database.OpenCollection("login_attempts", client)
+	now := time.Now()
+
+	// Forget failures that are older than the window
+	_, err := attemptsCollection.DeleteOne(ctx, bson.M{"key": key, "last_failure_at": bson.M{"$lt": now.Add(-failureWindow)}})
+	if err != nil {
+		return err
+	}
+
+	var attempts loginAttempts
+	err = attemptsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"key": key},
+		bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"last_failure_at": now}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempts)
+	if err != nil {
+		return err
+	}
+
+	if attempts.Failures <= policy.FreeAttempts {
+		return nil
+	}
+
+	lockout := policy.BaseLockout
+	for i := policy.FreeAttempts + 1; i < attempts.Failures && lockout < policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, policy.MaxLockout)
+
+	_, err = attemptsCollection.UpdateOne(ctx, bson.M{"key": key}, bson.M{"$set": bson.M{"locked_until": now.Add(lockout)}})
+	return err
+}
+
+// ResetLoginFailures clears the failures of a throttling key, after a successful login or an admin unlock.
+func ResetLoginFailures(key string, client *mongo.Client, c *gin.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	_, err := database.OpenCollection("login_attempts", client).DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
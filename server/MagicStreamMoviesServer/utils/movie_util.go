@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/eichiarakaki/magic-stream/models"
+	"golang.org/x/text/language"
+)
+
+// NormalizeMovie trims the text fields of a movie about to be written, drops empty and
+// repeated names, puts language tags in their canonical form and stamps it with the
+// current schema version. Lists are never nil,
+// so that they are stored as empty arrays rather than null.
+func NormalizeMovie(movie *models.Movie) {
+	movie.ImdbID = strings.TrimSpace(movie.ImdbID)
+	movie.Title = strings.TrimSpace(movie.Title)
+	movie.Synopsis = strings.TrimSpace(movie.Synopsis)
+	movie.AgeRating = strings.ToUpper(strings.TrimSpace(movie.AgeRating))
+	movie.Cast = normalizeNames(movie.Cast)
+	movie.Directors = normalizeNames(movie.Directors)
+	movie.Languages = normalizeLanguages(movie.Languages)
+	movie.SchemaVersion = models.MovieSchemaVersion
+}
+
+func normalizeNames(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name != "" && !slices.Contains(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// normalizeLanguages canonicalizes the language tags, so that "EN" and "en" are stored
+// alike. Invalid tags are kept for validation to reject.
+func normalizeLanguages(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if canonical, err := CanonicalLanguageTag(tag); err == nil {
+			tag = canonical
+		} else {
+			tag = strings.TrimSpace(tag)
+		}
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// CanonicalLanguageTag returns the canonical form of a BCP 47 language tag ("pt-br" becomes "pt-BR").
+func CanonicalLanguageTag(value string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return "", fmt.Errorf("invalid language %q", value)
+	}
+	return tag.String(), nil
+}
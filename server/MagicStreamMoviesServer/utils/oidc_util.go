@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCStateTTL is how long the user has to log in at the identity provider.
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCState is what the callback needs to finish an OIDC login started by the same browser.
+type OIDCState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+// oidcStateKey derives the signing key of OIDC state tokens from SecretKey,
+// so they can never be accepted as any other kind of token.
+func oidcStateKey() []byte {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte("oidc-state"))
+	return mac.Sum(nil)
+}
+
+// GenerateOIDCStateToken signs the state, nonce and PKCE code verifier of a login,
+// to be kept in an HttpOnly cookie until the identity provider redirects back.
+func GenerateOIDCStateToken(state, nonce, codeVerifier string) (string, error) {
+	claims := OIDCState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "MagicStream",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OIDCStateTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(oidcStateKey())
+}
+
+// ValidateOIDCStateToken checks an OIDC state token and returns its content.
+func ValidateOIDCStateToken(tokenString string) (*OIDCState, error) {
+	claims := &OIDCState{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return oidcStateKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.State == "" || claims.Nonce == "" || claims.CodeVerifier == "" {
+		return nil, errors.New("invalid OIDC state token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrInvalidOneTimeToken is returned for unknown, expired, already used or wrong-purpose tokens.
+// The cases are deliberately not distinguished.
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// IssueOneTimeToken creates a new single-use token for the user and returns its plain value.
+// Any previous unused token with the same purpose is discarded, so only the latest email works.
+// It takes a plain context because tokens are usually issued in the background, after the response was sent.
+func IssueOneTimeToken(userID, purpose string, ttl time.Duration, client *mongo.Client, parent context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(parent, 100*time.Second)
+	defer cancel()
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	rawToken := base64.RawURLEncoding.EncodeToString(buf)
+
+	tokens := database.OpenCollection("one_time_tokens", client)
+	_, err := tokens.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose, "used_at": bson.M{"$exists": false}})
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = tokens.InsertOne(ctx, models.OneTimeToken{
+		TokenHash: hashOneTimeToken(rawToken),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return rawToken, nil
+}
+
+// ConsumeOneTimeToken atomically marks the token as used and returns it.
+// Two concurrent requests with the same token cannot both succeed.
+func ConsumeOneTimeToken(rawToken, purpose string, client *mongo.Client, c *gin.Context) (*models.OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": hashOneTimeToken(rawToken),
+		"purpose":    purpose,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token models.OneTimeToken
+	err := database.OpenCollection("one_time_tokens", client).FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidOneTimeToken
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func hashOneTimeToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination defaults for list endpoints.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// GetPagination reads the page (1-based) and page_size query parameters.
+func GetPagination(c *gin.Context) (page, pageSize int64, err error) {
+	page, pageSize = 1, DefaultPageSize
+
+	if value := c.Query("page"); value != "" {
+		page, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+	}
+	if value := c.Query("page_size"); value != "" {
+		pageSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || pageSize < 1 || pageSize > MaxPageSize {
+			return 0, 0, errors.New("page_size must be between 1 and " + strconv.Itoa(MaxPageSize))
+		}
+	}
+	return page, pageSize, nil
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// HashSessionToken hashes an access or refresh token for storage in a session.
+// Tokens are signed and unguessable, so a fast hash is enough.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession stores a new session with its tokens. Expired sessions are dropped, and
+// so are the oldest ones beyond models.MaxSessions.
+func CreateSession(userID, sessionID, token, refreshToken string, mfa bool, client *mongo.Client, c *gin.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := bson.M{
+		"session_id":         sessionID,
+		"token_hash":         HashSessionToken(token),
+		"refresh_token_hash": HashSessionToken(refreshToken),
+		"mfa":                mfa,
+		"created_at":         now,
+		"refreshed_at":       now,
+		"expires_at":         now.Add(RefreshTokenTTL()),
+	}
+	open := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$sessions", bson.A{}}},
+		"cond":  bson.M{"$gt": bson.A{"$$this.expires_at", now}},
+	}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"sessions":   bson.M{"$slice": bson.A{bson.M{"$concatArrays": bson.A{open, bson.A{session}}}, -models.MaxSessions}},
+		"updated_at": now,
+	}}}}
+	_, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	return err
+}
+
+// RotateSession replaces the tokens of a session after a refresh. It reports false when
+// the session has ended or refreshToken is no longer its current refresh token.
+func RotateSession(userID, sessionID, refreshToken, newToken, newRefreshToken string, client *mongo.Client, c *gin.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"user_id": userID,
+		"sessions": bson.M{"$elemMatch": bson.M{
+			"session_id":         sessionID,
+			"refresh_token_hash": HashSessionToken(refreshToken),
+			"expires_at":         bson.M{"$gt": now},
+		}},
+	}
+	update := bson.M{"$set": bson.M{
+		"sessions.$.token_hash":         HashSessionToken(newToken),
+		"sessions.$.refresh_token_hash": HashSessionToken(newRefreshToken),
+		"sessions.$.refreshed_at":       now,
+		"sessions.$.expires_at":         now.Add(RefreshTokenTTL()),
+		"updated_at":                    now,
+	}}
+	result, err := database.OpenCollection("users", client).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// EndSession ends one session of the user, e.g. on logout.
+func EndSession(userID, sessionID string, client *mongo.Client, c *gin.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$pull": bson.M{"sessions": bson.M{"session_id": sessionID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	_, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	return err
+}
+
+// RevokeUserSessions ends every session of the user, on all devices.
+func RevokeUserSessions(userID string, client *mongo.Client, c *gin.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"sessions": bson.A{}, "updated_at": time.Now()}}
+	_, err := database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	return err
+}
+
+// FindSession returns the session of the user with the given ID, or nil.
+func FindSession(user *models.User, sessionID string) *models.Session {
+	if user == nil || sessionID == "" {
+		return nil
+	}
+	for i := range user.Sessions {
+		if user.Sessions[i].SessionID == sessionID {
+			return &user.Sessions[i]
+		}
+	}
+	return nil
+}
+
+// IsActiveSession reports whether the access token is the current one of an open session
+// of the user, and the account is not disabled. Logging out, resetting the password or
+// being logged out by an admin removes sessions, which ends them even though their JWTs
+// have not expired yet.
+func IsActiveSession(token string, claims *SignedDetails, user *models.User) bool {
+	if user == nil || user.Disabled {
+		return false
+	}
+	session := FindSession(user, claims.SessionID)
+	return session != nil &&
+		session.ExpiresAt.After(time.Now()) &&
+		subtle.ConstantTimeCompare([]byte(session.TokenHash), []byte(HashSessionToken(token))) == 1
+}
@@ -2,16 +2,23 @@ package utils
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"log"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/eichiarakaki/magic-stream/database"
+	"github.com/eichiarakaki/magic-stream/models"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // SignedDetails represents the custom JWT claims that will be embedded
@@ -23,6 +30,8 @@ type SignedDetails struct {
 	LastName             string `json:"last_name"`
 	Role                 string `json:"role"`
 	UserID               string `json:"user_id"`
+	MFA                  bool   `json:"mfa,omitempty"` // The session was opened with a second factor
+	SessionID            string `json:"sid"`           // The models.Session the token belongs to
 	jwt.RegisteredClaims        // Standard JWT fields (issuer, expiration, issuedAt…)
 }
 
@@ -31,9 +40,36 @@ type SignedDetails struct {
 var SecretKey = os.Getenv("SECRET_KEY")
 var SecretRefreshKey = os.Getenv("SECRET_REFRESH_KEY")
 
+// Token lifetimes, overridable with ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL (Go durations, e.g. "30m").
+// Cookie lifetimes are derived from these values.
+var AccessTokenTTL = sync.OnceValue(func() time.Duration {
+	return DurationFromEnv("ACCESS_TOKEN_TTL", time.Hour)
+})
+var RefreshTokenTTL = sync.OnceValue(func() time.Duration {
+	return DurationFromEnv("REFRESH_TOKEN_TTL", 24*time.Hour)
+})
+
+// DurationFromEnv reads a Go duration (e.g. "30s") from the environment, falling back
+// to the default when the variable is unset or invalid.
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
 // GenerateAllTokens creates and signs both an access token and a refresh token.
-// The access token contains user information and expires in 1 hour.
-func GenerateAllTokens(email, firstName, lastName, role, userID string) (string, string, error) {
+// The access token contains user information and expires after AccessTokenTTL (1 hour by default),
+// the refresh token after RefreshTokenTTL (24 hours by default).
+// Both belong to the session sessionID; mfa records whether the user completed
+// two-factor authentication for this session.
+func GenerateAllTokens(email, firstName, lastName, role, userID, sessionID string, mfa bool) (string, string, error) {
 
 	// Access token claims
 	claims := &SignedDetails{
@@ -42,10 +78,12 @@ func GenerateAllTokens(email, firstName, lastName, role, userID string) (string,
 		LastName:  lastName,
 		Role:      role,
 		UserID:    userID,
+		MFA:       mfa,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "MagicStream",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)), // 1 hour
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 		},
 	}
 
@@ -63,10 +101,12 @@ func GenerateAllTokens(email, firstName, lastName, role, userID string) (string,
 		LastName:  lastName,
 		Role:      role,
 		UserID:    userID,
+		MFA:       mfa,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "MagicStream",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL())),
 		},
 	}
 
@@ -80,51 +120,44 @@ func GenerateAllTokens(email, firstName, lastName, role, userID string) (string,
 	return signedToken, signedRefreshToken, nil
 }
 
-// UpdateAllTokens stores the new access token and refresh token in the user's MongoDB document.
-// This is typically called after login or when refreshing tokens.
-func UpdateAllTokens(token, refreshToken, userID string, client *mongo.Client, c *gin.Context) (err error) {
-
-	// Create a timeout context for the database update operation
+// GetSessionUser loads the parts of the user document needed to authorise a request
+// (sessions, role and account state). It returns nil when the user does not exist.
+func GetSessionUser(userID string, client *mongo.Client, c *gin.Context) (*models.User, error) {
 	var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
 	defer cancel()
 
-	// RFC3339 timestamp for updated_at
-	updateAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-	// MongoDB update object
-	updateData := bson.M{
-		"$set": bson.M{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"updated_at":    updateAt,
-		},
-	}
+	projection := bson.M{"user_id": 1, "role": 1, "sessions": 1, "email_verified": 1, "disabled": 1}
+	opts := options.FindOne().SetProjection(projection)
 
-	// Update the user document by ID
-	_, err = database.OpenCollection("users", client).UpdateOne(ctx, bson.M{"user_id": userID}, updateData)
+	var user models.User
+	err := database.OpenCollection("users", client).FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&user)
 	if err != nil {
-		return err
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	return nil
+	return &user, nil
 }
 
-func GetAccessToken(c *gin.Context) (string, error) {
-	//authHeader := c.Request.Header.Get("Authorization")
-	//if authHeader == "" {
-	//	return "", errors.New("no authorization header found")
-	//}
-	//
-	//tokenString := authHeader[len("Bearer "):]
-	//if tokenString == "" {
-	//	return "", errors.New("no bearer token found")
-	//}
-
-	tokenString, err := c.Cookie("access_token")
+// GetAccessToken returns the access token sent by the client together with how it was sent:
+// "bearer" for an Authorization header, "cookie" for the access_token cookie.
+func GetAccessToken(c *gin.Context) (string, string, error) {
+	authHeader := c.Request.Header.Get("Authorization")
+	if authHeader != "" {
+		tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
+		if !found || tokenString == "" {
+			return "", "", errors.New("no bearer token found")
+		}
+		return tokenString, "bearer", nil
+	}
+
+	tokenString, err := GetCookiePolicy().Cookie(c, AccessTokenCookie)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return tokenString, nil
+	return tokenString, "cookie", nil
 }
 
 // ValidateToken validates a JWT string and returns its claims.
@@ -197,3 +230,60 @@ func ValidateRefreshToken(tokenString string) (*SignedDetails, error) {
 
 	return claims, nil
 }
+
+// mfaChallengeTTL is how long the user has to enter their second factor after the password.
+const mfaChallengeTTL = 5 * time.Minute
+
+// mfaChallengeKey derives the signing key of MFA challenge tokens from SecretKey,
+// so a challenge token can never be accepted as an access token (or the reverse).
+func mfaChallengeKey() []byte {
+	mac := hmac.New(sha256.New, []byte(SecretKey))
+	mac.Write([]byte("mfa-challenge"))
+	return mac.Sum(nil)
+}
+
+// GenerateMFAChallengeToken returns a short-lived token proving that the user
+// passed the password step of the login. It is exchanged at /login/mfa for a session.
+func GenerateMFAChallengeToken(userID string) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    "MagicStream",
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaChallengeTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(mfaChallengeKey())
+}
+
+// ValidateMFAChallengeToken checks an MFA challenge token and returns the user ID it was issued for.
+func ValidateMFAChallengeToken(tokenString string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return mfaChallengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("invalid MFA challenge token")
+	}
+	return claims.Subject, nil
+}
+
+func GetMFAFromContext(c *gin.Context) bool {
+	mfa, exists := c.Get("mfa")
+	if !exists {
+		return false
+	}
+
+	return mfa.(bool)
+}
+
+// GetSessionIDFromContext returns the session of the access token; it is empty for API keys.
+func GetSessionIDFromContext(c *gin.Context) string {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return ""
+	}
+
+	return sessionID.(string)
+}